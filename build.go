@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jcgregorio/piccolo/piccolo"
+)
+
+// Values of the flags that control building.
+var (
+	jobs   int
+	dryRun bool
+	drafts bool
+)
+
+// buildFlags adds the flags that control building to the FlagSet.
+func buildFlags(fs *flag.FlagSet) {
+	fs.IntVar(&jobs, "j", 0, "The number of files to process in parallel. Defaults to the number of CPUs.")
+	fs.BoolVar(&drafts, "drafts", false, "Publish draft entries.")
+	fs.BoolVar(&dryRun, "dry-run", false, "Report the files in the output directory that no longer correspond to a source instead of removing them.")
+}
+
+// build builds the site described by the docset d.
+func build(d *piccolo.DocSet) error {
+	b := piccolo.NewBuilder(d, d.Config)
+	b.Logf = logf
+	b.Jobs = jobs
+	b.DryRun = dryRun
+	b.Drafts = drafts
+	report, err := b.Build(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, w := range report.Warnings {
+		fmt.Fprintln(os.Stderr, w)
+	}
+	if dryRun {
+		for _, path := range report.Removed {
+			fmt.Printf("Would remove: %s\n", path)
+		}
+	}
+	logf("Built %d entries, expanded %d, copied %d files.\n", len(report.Entries), len(report.Included), len(report.Verbatim))
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jcgregorio/piccolo/piccolo"
+)
+
+// Values of the flags of the check command.
+var (
+	checkExternal bool
+	checkTimeout  time.Duration
+)
+
+var checkCmd = &Command{
+	Name:  "check",
+	Short: "Check the site for problems, and the last build for broken links.",
+	Flags: func(fs *flag.FlagSet) {
+		fs.BoolVar(&checkExternal, "external", false, "Also check links to other sites.")
+		fs.DurationVar(&checkTimeout, "timeout", 10*time.Second, "How long to wait for each link to another site.")
+	},
+	Run: func(d *piccolo.DocSet, args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		problems := check(d)
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("Found %d problem(s).", len(problems))
+		}
+		return nil
+	},
+}
+
+// check looks for problems in the docset that would stop or spoil a build,
+// such as templates or includes that fail to load and entries that fail to
+// parse. It returns a description of each problem found.
+func check(d *piccolo.DocSet) []string {
+	problems := []string{}
+	if _, err := piccolo.LoadTemplates(d.Root, d.Config); err != nil {
+		problems = append(problems, fmt.Sprintf("Templates: %v", err))
+	}
+	if _, err := piccolo.NewBuilder(d, d.Config).LoadIncludes(); err != nil {
+		problems = append(problems, fmt.Sprintf("Includes: %v", err))
+	}
+	walker := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", path, err))
+			return nil
+		}
+		attr, err := d.Path(path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && attr.Has(piccolo.IGNORE) {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && piccolo.IsEntry(path, attr) {
+			logf("CHECK:    %v\n", path)
+			fileinfo, _, err := piccolo.EntryInfo(path)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", path, err))
+			} else if fileinfo.Title == "" {
+				problems = append(problems, fmt.Sprintf("%s: Missing <title>.", path))
+			}
+		}
+		return nil
+	}
+	if err := filepath.Walk(d.Root, walker); err != nil {
+		problems = append(problems, fmt.Sprintf("Walking: %v", err))
+	}
+	return append(problems, checkLinks(d)...)
+}
+
+// checkLinks looks for broken links in the output of the last build, if
+// there is one, and returns a description of each broken link found.
+func checkLinks(d *piccolo.DocSet) []string {
+	problems := []string{}
+	if _, err := os.Stat(filepath.Join(d.Root, d.Config.Output)); os.IsNotExist(err) {
+		logf("No output to check the links of, run build first.\n")
+		return problems
+	}
+	report, err := piccolo.CheckLinks(d)
+	if err != nil {
+		return append(problems, fmt.Sprintf("Links: %v", err))
+	}
+	linkProblems := report.Problems
+	if checkExternal {
+		logf("Checking %d external links.\n", len(report.External))
+		client := &http.Client{Timeout: checkTimeout}
+		linkProblems = append(linkProblems, piccolo.CheckExternalLinks(context.Background(), client, report.External)...)
+	} else {
+		logf("Skipped %d external links, use --external to check them.\n", len(report.External))
+	}
+	for _, p := range linkProblems {
+		problems = append(problems, p.String())
+	}
+	return problems
+}
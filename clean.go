@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/jcgregorio/piccolo/piccolo"
+)
+
+var cleanCmd = &Command{
+	Name:  "clean",
+	Short: "Remove everything from the output directory.",
+	Run: func(d *piccolo.DocSet, args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		return clean(d)
+	},
+}
+
+// clean removes the contents of the output directory, but not the directory
+// itself.
+func clean(d *piccolo.DocSet) error {
+	dst := filepath.Join(d.Root, d.Config.Output)
+	entries, err := os.ReadDir(dst)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		path := filepath.Join(dst, e.Name())
+		logf("REMOVE:   %v\n", path)
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jcgregorio/piccolo/piccolo"
+)
+
+// newDir is the value of the --dir flag of the new command.
+var newDir string
+
+var newCmd = &Command{
+	Name:  "new",
+	Args:  "\"Title\"",
+	Short: "Create a new entry with the given title.",
+	Flags: func(fs *flag.FlagSet) {
+		fs.StringVar(&newDir, "dir", "", "The .include directory to create the entry in, relative to the root. Defaults to the .maintarget directory if it is included, otherwise the first .include directory.")
+	},
+	Run: func(d *piccolo.DocSet, args []string) error {
+		if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+			return errUsage
+		}
+		path, err := newEntry(d, newDir, args[0], time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Println(path)
+		return nil
+	},
+}
+
+// defaultNewDir returns the directory new entries go in if --dir isn't given,
+// the .maintarget directory if it is included, otherwise the first .include
+// directory.
+func defaultNewDir(d *piccolo.DocSet) (string, error) {
+	// Walk the whole site, as that's what finds the .maintarget.
+	output := filepath.Join(d.Root, d.Config.Output)
+	first := ""
+	err := filepath.Walk(d.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		attr, err := d.Path(path)
+		if err != nil {
+			return err
+		}
+		if attr.Has(piccolo.IGNORE) || path == output {
+			return filepath.SkipDir
+		}
+		if attr.Has(piccolo.INCLUDE) && first == "" {
+			first = path
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if d.Main != "" {
+		if attr, err := d.Path(d.Main); err == nil && attr.Has(piccolo.INCLUDE) {
+			return d.Main, nil
+		}
+	}
+	if first == "" {
+		return "", fmt.Errorf("No .include directory found to create the entry in.")
+	}
+	return first, nil
+}
+
+// newEntry creates a new entry in dir, relative to the root, or in the
+// default directory if dir is empty, and returns its path.
+func newEntry(d *piccolo.DocSet, dir, title string, created time.Time) (string, error) {
+	var err error
+	if dir == "" {
+		if dir, err = defaultNewDir(d); err != nil {
+			return "", err
+		}
+	} else if !filepath.IsAbs(dir) {
+		dir = filepath.Join(d.Root, dir)
+	}
+	attr, err := d.Path(dir)
+	if err != nil {
+		return "", err
+	}
+	if !attr.Has(piccolo.INCLUDE) {
+		return "", fmt.Errorf("%s is not an .include directory.", dir)
+	}
+	slug := piccolo.Slugify(title)
+	if slug == "" {
+		return "", fmt.Errorf("Can't make a filename from the title %q.", title)
+	}
+	// Scaffold into memory first, and remove the file if writing it fails, so
+	// a failure never leaves a partial entry behind.
+	var buf bytes.Buffer
+	if err := piccolo.Scaffold(&buf, title, created); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, slug+".html")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
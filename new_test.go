@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcgregorio/piccolo/piccolo"
+)
+
+func TestNewEntry(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{".root", ".verbatim", "a/.include"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v\n", err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			t.Fatalf("Failed to write: %v\n", err)
+		}
+	}
+	d, err := piccolo.NewDocSet(root)
+	if err != nil {
+		t.Fatalf("Failed to build DocSet: %v\n", err)
+	}
+	created := time.Date(2009, 7, 4, 12, 0, 0, 0, time.UTC)
+	path, err := newEntry(d, "a", "Hello, World", created)
+	if err != nil {
+		t.Fatalf("Failed to create entry: %v\n", err)
+	}
+	if got, want := path, filepath.Join(root, "a", "hello-world.html"); got != want {
+		t.Errorf("Got %v, Want %v\n", got, want)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read entry: %v\n", err)
+	}
+	if !strings.Contains(string(b), "<title>Hello, World</title>") {
+		t.Errorf("Entry missing title:\n%s\n", b)
+	}
+
+	// An existing entry is never overwritten, or removed.
+	if _, err := newEntry(d, "a", "Hello World", created); err == nil {
+		t.Errorf("Overwrote an existing entry.\n")
+	}
+	if after, err := os.ReadFile(path); err != nil || string(after) != string(b) {
+		t.Errorf("Existing entry changed: %v\n", err)
+	}
+	if _, err := newEntry(d, "a", "!!", created); err == nil {
+		t.Errorf("Created an entry without a filename.\n")
+	}
+
+	// Failures leave nothing behind.
+	files, err := os.ReadDir(filepath.Join(root, "a"))
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v\n", err)
+	}
+	if got, want := len(files), 2; got != want {
+		t.Errorf("Wrong number of files: Got %d, Want %d\n", got, want)
+	}
+}
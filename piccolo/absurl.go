@@ -0,0 +1,87 @@
+package piccolo
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// urlAttrs are the attributes that hold a single URL.
+var urlAttrs = map[string]bool{
+	"href": true,
+	"src":  true,
+}
+
+// resolve returns ref resolved against base, or ref unchanged if it can't be
+// parsed.
+func resolve(base *url.URL, ref string) string {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
+
+// resolveSrcset resolves every URL of a srcset attribute, e.g.
+// "a.png 1x, b.png 2x", against base.
+func resolveSrcset(base *url.URL, srcset string) string {
+	candidates := strings.Split(srcset, ",")
+	for i, c := range candidates {
+		fields := strings.Fields(c)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = resolve(base, fields[0])
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// AbsoluteURLs rewrites the href, src and srcset attributes of the nodes, and
+// of all their descendants, so that relative URLs are resolved against base.
+func AbsoluteURLs(nodes []*html.Node, base *url.URL) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i, a := range n.Attr {
+				if a.Namespace != "" {
+					continue
+				}
+				if urlAttrs[a.Key] {
+					n.Attr[i].Val = resolve(base, a.Val)
+				} else if a.Key == "srcset" {
+					n.Attr[i].Val = resolveSrcset(base, a.Val)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+}
+
+// DataURIs rewrites the src attributes of the img nodes, and of all their
+// descendants, that are the URL of one of the files to be a data URI of the
+// file instead. The files are indexed by URL.
+func DataURIs(nodes []*html.Node, files map[string][]byte) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "img" {
+			for i, a := range n.Attr {
+				if b, ok := files[a.Val]; ok && a.Key == "src" && a.Namespace == "" {
+					n.Attr[i].Val = dataURI(a.Val, b)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+}
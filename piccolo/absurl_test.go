@@ -0,0 +1,67 @@
+package piccolo
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func TestAbsoluteURLs(t *testing.T) {
+	base, err := url.Parse("https://example.org/a/test")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v\n", err)
+	}
+	testCases := []struct {
+		in   string
+		want string
+	}{
+		{`<img src="foo.png">`, `<img src="https://example.org/a/foo.png"/>`},
+		{`<a href="/a/other">x</a>`, `<a href="https://example.org/a/other">x</a>`},
+		{`<a href="../b/c">x</a>`, `<a href="https://example.org/b/c">x</a>`},
+		{`<a href="#note">x</a>`, `<a href="https://example.org/a/test#note">x</a>`},
+		{`<a href="https://other.org/">x</a>`, `<a href="https://other.org/">x</a>`},
+		{`<a href="mailto:joe@example.org">x</a>`, `<a href="mailto:joe@example.org">x</a>`},
+		{`<img srcset="a.png 1x, /b.png 2x">`, `<img srcset="https://example.org/a/a.png 1x, https://example.org/b.png 2x"/>`},
+		{`<p><span><img src="deep.png"></span></p>`, `<p><span><img src="https://example.org/a/deep.png"/></span></p>`},
+		{`<p title="foo.png">foo.png</p>`, `<p title="foo.png">foo.png</p>`},
+	}
+	for _, tc := range testCases {
+		nodes, err := html.ParseFragment(strings.NewReader(tc.in), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v\n", tc.in, err)
+		}
+		AbsoluteURLs(nodes, base)
+		if got := StrFromNodes(nodes); got != tc.want {
+			t.Errorf("Got %v, Want %v\n", got, tc.want)
+		}
+	}
+}
+
+func TestDataURIs(t *testing.T) {
+	files := map[string][]byte{
+		"/latex/x.png": []byte("PNG"),
+		"/latex/y.svg": []byte("<svg/>"),
+	}
+	testCases := []struct {
+		in   string
+		want string
+	}{
+		{`<img src="/latex/x.png">`, `<img src="data:image/png;base64,UE5H"/>`},
+		{`<p><img src="/latex/y.svg" alt="y"></p>`, `<p><img src="data:image/svg+xml;base64,PHN2Zy8+" alt="y"/></p>`},
+		{`<img src="/latex/z.png">`, `<img src="/latex/z.png"/>`},
+		{`<a href="/latex/x.png">x</a>`, `<a href="/latex/x.png">x</a>`},
+	}
+	for _, tc := range testCases {
+		nodes, err := html.ParseFragment(strings.NewReader(tc.in), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v\n", tc.in, err)
+		}
+		DataURIs(nodes, files)
+		if got := StrFromNodes(nodes); got != tc.want {
+			t.Errorf("Got %v, Want %v\n", got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package piccolo
+
+import (
+	"fmt"
+	"path/filepath"
+	"text/template"
+	"time"
+)
+
+// Year is a year of the archive, and the months in it that have entries.
+type Year struct {
+	Year int
+
+	// URL is the relative URL of the archive page for the year.
+	URL string
+
+	// Months with entries, newest first.
+	Months []*Month
+}
+
+// Entries returns all the entries of the year, newest first.
+func (y *Year) Entries() []*Entry {
+	entries := []*Entry{}
+	for _, m := range y.Months {
+		entries = append(entries, m.Entries...)
+	}
+	return entries
+}
+
+// Count is the number of entries in the year.
+func (y *Year) Count() int {
+	n := 0
+	for _, m := range y.Months {
+		n += len(m.Entries)
+	}
+	return n
+}
+
+// Month is a month of the archive.
+type Month struct {
+	Year  int
+	Month time.Month
+
+	// URL is the relative URL of the archive page for the month.
+	URL string
+
+	// Entries in the month, newest first.
+	Entries []*Entry
+}
+
+// Name is the short name of the month, e.g. "Jul".
+func (m *Month) Name() string {
+	return ShortMonth(m.Month)
+}
+
+// Count is the number of entries in the month.
+func (m *Month) Count() int {
+	return len(m.Entries)
+}
+
+// Archive groups the entries, which must be sorted newest first, by year and
+// month. The URLs of the years and months are relative to base, the URL of
+// the archive directory, e.g. base + "2009/07/".
+func Archive(entries []*Entry, base string) []*Year {
+	years := []*Year{}
+	var year *Year
+	var month *Month
+	for _, e := range entries {
+		y, m := e.Created.Year(), e.Created.Month()
+		if year == nil || year.Year != y {
+			year = &Year{
+				Year: y,
+				URL:  fmt.Sprintf("%s%d/", base, y),
+			}
+			years = append(years, year)
+			month = nil
+		}
+		if month == nil || month.Month != m {
+			month = &Month{
+				Year:  y,
+				Month: m,
+				URL:   fmt.Sprintf("%s%d/%02d/", base, y, m),
+			}
+			year.Months = append(year.Months, month)
+		}
+		month.Entries = append(month.Entries, e)
+	}
+	return years
+}
+
+// buildDateArchives writes an archive page for each year, in a directory
+// named for the year under the archive target directory, and if months is
+// true a page for each month in a directory named for the month under that.
+func (b *Builder) buildDateArchives(t *template.Template, site *TemplateData, months bool) error {
+	dir := b.d.Archive
+	if dir == "" {
+		dir = b.d.Root
+	}
+	// Each page needs its own datediff, otherwise the headings depend on the
+	// page expanded before it.
+	expand := func(data *TemplateData, pageDir string) error {
+		fresh, err := withFreshState(t)
+		if err != nil {
+			return err
+		}
+		if err := b.expandPage(fresh, data, pageDir, "index.html"); err != nil {
+			return err
+		}
+		u, err := b.dirURL(pageDir)
+		if err != nil {
+			return err
+		}
+		b.listed = append(b.listed, SitemapURL{Loc: u, LastMod: lastUpdated(data.Entries)})
+		return nil
+	}
+	for _, y := range site.Years {
+		yearDir := filepath.Join(dir, fmt.Sprintf("%d", y.Year))
+		data := *site
+		data.Year = y
+		data.Entries = y.Entries()
+		if err := expand(&data, yearDir); err != nil {
+			return fmt.Errorf("Error building archive for %d: %v", y.Year, err)
+		}
+		if !months {
+			continue
+		}
+		for _, m := range y.Months {
+			data := *site
+			data.Year = y
+			data.Month = m
+			data.Entries = m.Entries
+			if err := expand(&data, filepath.Join(yearDir, fmt.Sprintf("%02d", m.Month))); err != nil {
+				return fmt.Errorf("Error building archive for %s %d: %v", m.Name(), y.Year, err)
+			}
+		}
+	}
+	return nil
+}
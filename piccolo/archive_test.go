@@ -0,0 +1,43 @@
+package piccolo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	date := func(s string) time.Time {
+		ts, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatalf("Failed to parse: %v\n", err)
+		}
+		return ts
+	}
+	entries := []*Entry{
+		{Title: "a", Created: date("2010-02-01")},
+		{Title: "b", Created: date("2009-07-05")},
+		{Title: "c", Created: date("2009-07-03")},
+		{Title: "d", Created: date("2009-01-01")},
+	}
+	years := Archive(entries, "/archives/")
+	if got, want := len(years), 2; got != want {
+		t.Fatalf("Wrong number of years: Got %d, Want %d\n", got, want)
+	}
+	y := years[1]
+	if y.Year != 2009 || y.URL != "/archives/2009/" || y.Count() != 3 {
+		t.Errorf("Wrong year: Got %d %s %d\n", y.Year, y.URL, y.Count())
+	}
+	if got, want := len(y.Months), 2; got != want {
+		t.Fatalf("Wrong number of months: Got %d, Want %d\n", got, want)
+	}
+	m := y.Months[0]
+	if m.Name() != "Jul" || m.URL != "/archives/2009/07/" || m.Count() != 2 {
+		t.Errorf("Wrong month: Got %s %s %d\n", m.Name(), m.URL, m.Count())
+	}
+	if got := y.Entries(); got[0] != entries[1] || got[2] != entries[3] {
+		t.Errorf("Wrong entries for the year, order must be kept.\n")
+	}
+	if got := Archive(nil, "/"); len(got) != 0 {
+		t.Errorf("Wrong archive of no entries: Got %v\n", got)
+	}
+}
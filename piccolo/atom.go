@@ -0,0 +1,117 @@
+package piccolo
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// The elements of an Atom 1.0 feed, see RFC 4287.
+
+type atomFeed struct {
+	XMLName   xml.Name      `xml:"http://www.w3.org/2005/Atom feed"`
+	Base      string        `xml:"xml:base,attr,omitempty"`
+	Title     atomText      `xml:"title"`
+	Links     []atomLink    `xml:"link"`
+	Updated   string        `xml:"updated"`
+	Author    *atomPerson   `xml:"author,omitempty"`
+	ID        string        `xml:"id"`
+	Generator atomGenerator `xml:"generator"`
+	Entries   []atomEntry   `xml:"entry"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomGenerator struct {
+	URI  string `xml:"uri,attr"`
+	Text string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Base string `xml:"xml:base,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title      atomText       `xml:"title"`
+	Links      []atomLink     `xml:"link"`
+	ID         string         `xml:"id"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     *atomPerson    `xml:"author,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    atomContent    `xml:"content"`
+}
+
+// WriteAtom writes the feed as Atom 1.0.
+//
+// Relative links in the content of the entries are resolved against the URL
+// of each entry, by setting xml:base on the content. Atom needs an author for
+// every entry, so if the feed has no Author the host of the domain is used.
+func WriteAtom(w io.Writer, f *Feed) error {
+	feed := atomFeed{
+		Base:  f.AbsURL("/"),
+		Title: atomText{Type: "text", Text: f.Title},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: f.AbsURL(f.URL)},
+			{Rel: "alternate", Type: "text/html", Href: f.AbsURL(f.Link)},
+		},
+		Updated:   f.Updated().Format(time.RFC3339),
+		ID:        f.AbsURL(f.URL),
+		Generator: atomGenerator{URI: "https://github.com/jcgregorio/piccolo", Text: "piccolo"},
+	}
+	feed.Author = &atomPerson{Name: f.Author}
+	if f.Author == "" {
+		feed.Author.Name = f.host()
+	}
+	for _, e := range f.Entries {
+		entry := atomEntry{
+			Title:     atomText{Type: "text", Text: e.Title},
+			Links:     []atomLink{{Rel: "alternate", Type: "text/html", Href: f.AbsURL(e.URL)}},
+			ID:        f.EntryID(e),
+			Published: e.Created.Format(time.RFC3339),
+			Updated:   entryUpdated(e).Format(time.RFC3339),
+			Content:   atomContent{Type: "html", Base: f.AbsURL(e.URL), Body: e.FeedBody},
+		}
+		if e.Author != "" {
+			entry.Author = &atomPerson{Name: e.Author}
+		}
+		for _, term := range append(append([]string{}, e.Tags...), e.Categories...) {
+			entry.Categories = append(entry.Categories, atomCategory{Term: term})
+		}
+		if e.Summary != "" {
+			entry.Summary = &atomText{Type: "text", Text: e.Summary}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,111 @@
+package piccolo
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteAtom(t *testing.T) {
+	created := time.Date(2009, 7, 4, 12, 0, 0, 0, time.UTC)
+	f := &Feed{
+		Title:  "Tom & Jerry's <Blog>",
+		Domain: "https://example.org/",
+		Author: "Joe Gregorio",
+		URL:    "/feed/index.atom",
+		Link:   "/",
+		Entries: []*Entry{
+			{
+				Title:    "Older, but updated last",
+				URL:      "/a/old",
+				Created:  created,
+				Updated:  created.Add(48 * time.Hour),
+				Tags:     []string{"go"},
+				FeedBody: `<p>A <a href="b/c.html">link</a> & ]]> </p>`,
+			},
+			{
+				Title:   "Newer",
+				URL:     "/a/new",
+				Author:  "Someone Else",
+				Created: created.Add(24 * time.Hour),
+				Updated: created,
+				Summary: "A <summary>.",
+			},
+		},
+	}
+	var buf bytes.Buffer
+	if err := WriteAtom(&buf, f); err != nil {
+		t.Fatalf("Failed to write feed: %v\n", err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Errorf("Missing XML declaration:\n%s\n", buf.String())
+	}
+
+	// Parse it back to check it is well formed and the values survive.
+	var got atomFeed
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to parse feed: %v\n%s\n", err, buf.String())
+	}
+	if got.Title.Text != f.Title {
+		t.Errorf("Wrong title: Got %q, Want %q\n", got.Title.Text, f.Title)
+	}
+	if got, want := got.Updated, "2009-07-06T12:00:00Z"; got != want {
+		t.Errorf("Wrong feed updated: Got %s, Want %s\n", got, want)
+	}
+	if got, want := got.ID, "https://example.org/feed/index.atom"; got != want {
+		t.Errorf("Wrong feed id: Got %s, Want %s\n", got, want)
+	}
+	if got, want := len(got.Entries), 2; got != want {
+		t.Fatalf("Wrong number of entries: Got %d, Want %d\n", got, want)
+	}
+	old, new := got.Entries[0], got.Entries[1]
+	if old.Content.Body != f.Entries[0].FeedBody {
+		t.Errorf("Body not escaped correctly: Got %q, Want %q\n", old.Content.Body, f.Entries[0].FeedBody)
+	}
+	if want := `<content type="html" xml:base="https://example.org/a/old">`; !strings.Contains(buf.String(), want) {
+		t.Errorf("Missing xml:base on content:\n%s\n", buf.String())
+	}
+	if got, want := old.ID, "tag:example.org,2009-07-04:/a/old"; got != want {
+		t.Errorf("Wrong entry id: Got %s, Want %s\n", got, want)
+	}
+	if old.Published != "2009-07-04T12:00:00Z" || old.Updated != "2009-07-06T12:00:00Z" {
+		t.Errorf("Wrong entry times: Got %s %s\n", old.Published, old.Updated)
+	}
+	// Updated is never before published.
+	if new.Published != "2009-07-05T12:00:00Z" || new.Updated != "2009-07-05T12:00:00Z" {
+		t.Errorf("Wrong entry times: Got %s %s\n", new.Published, new.Updated)
+	}
+	if new.Author == nil || new.Author.Name != "Someone Else" {
+		t.Errorf("Wrong entry author: Got %v\n", new.Author)
+	}
+	if new.Summary == nil || new.Summary.Text != "A <summary>." {
+		t.Errorf("Wrong entry summary: Got %v\n", new.Summary)
+	}
+	if len(old.Categories) != 1 || old.Categories[0].Term != "go" {
+		t.Errorf("Wrong categories: Got %v\n", old.Categories)
+	}
+}
+
+func TestWriteAtomNoAuthor(t *testing.T) {
+	f := &Feed{
+		Title:   "Blog",
+		Domain:  "https://example.org/",
+		URL:     "/feed/index.atom",
+		Link:    "/",
+		Entries: []*Entry{{Title: "Entry", URL: "/a/entry", Created: time.Date(2009, 7, 4, 12, 0, 0, 0, time.UTC)}},
+	}
+	var buf bytes.Buffer
+	if err := WriteAtom(&buf, f); err != nil {
+		t.Fatalf("Failed to write feed: %v\n", err)
+	}
+	var got atomFeed
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to parse feed: %v\n%s\n", err, buf.String())
+	}
+	// Without an author the feed is invalid, so the host stands in for one.
+	if got.Author == nil || got.Author.Name != "example.org" {
+		t.Errorf("Wrong author: Got %v, Want example.org\n", got.Author)
+	}
+}
@@ -0,0 +1,871 @@
+package piccolo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// BuildReport describes what a Build did.
+type BuildReport struct {
+	// Included are the destination paths of the entries that were expanded
+	// through the entry template.
+	Included []string
+
+	// Verbatim are the destination paths of the files that were copied.
+	Verbatim []string
+
+	// Entries are all the entries found, sorted newest first.
+	Entries []*Entry
+
+	// Removed are the paths of files in the output directory that weren't
+	// produced by the build, and so were deleted, or would have been if
+	// DryRun is set.
+	Removed []string
+
+	// Held are the source paths of the entries that weren't published
+	// because they are drafts or their created time is in the future.
+	Held []string
+
+	// Warnings are problems that didn't stop the build.
+	Warnings []string
+}
+
+// Builder builds a site from a DocSet.
+type Builder struct {
+	d *DocSet
+	c *Config
+
+	// logMutex serializes calls to Logf.
+	logMutex sync.Mutex
+
+	// manifest is the manifest from the previous build.
+	manifest *Manifest
+
+	// writtenMutex protects written.
+	writtenMutex sync.Mutex
+
+	// written are the paths of all the files expanded by this build.
+	written map[string]bool
+
+	// listed are the pages generated by this build, other than the main page
+	// and the archive, that go in the sitemap. Loc is the relative URL.
+	listed []SitemapURL
+
+	// transforms are applied to every entry, in order.
+	transforms []Transform
+
+	// Logf, if not nil, is called with a progress message for every file
+	// written. It may be called from multiple goroutines.
+	Logf func(format string, args ...interface{})
+
+	// Jobs is the number of files processed in parallel. Defaults to the
+	// number of CPUs if <= 0.
+	Jobs int
+
+	// DryRun, if true, means files in the output directory that no longer
+	// correspond to a source are only reported, not removed.
+	DryRun bool
+
+	// Drafts, if true, means draft entries are published.
+	Drafts bool
+
+	// Now returns the current time, used to hold back entries whose created
+	// time is in the future. Defaults to time.Now if nil.
+	Now func() time.Time
+}
+
+// NewBuilder returns a Builder for the DocSet d using the config c.
+func NewBuilder(d *DocSet, c *Config) *Builder {
+	return &Builder{
+		d: d,
+		c: c,
+	}
+}
+
+func (b *Builder) now() time.Time {
+	if b.Now != nil {
+		return b.Now()
+	}
+	return time.Now()
+}
+
+func (b *Builder) logf(format string, args ...interface{}) {
+	if b.Logf != nil {
+		b.logMutex.Lock()
+		defer b.logMutex.Unlock()
+		b.Logf(format, args...)
+	}
+}
+
+// dest tranforms a src path into a destination path.
+func (b *Builder) dest(path string) (string, error) {
+	rel, err := filepath.Rel(b.d.Root, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(b.d.Root, b.c.Output, rel), nil
+}
+
+// entryDest returns the destination of an entry, which is always an HTML
+// file.
+func (b *Builder) entryDest(path string) (string, error) {
+	dst, err := b.dest(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(dst, filepath.Ext(dst)) + ".html", nil
+}
+
+// expand expands the template with the given data into the file dst.
+func (b *Builder) expand(t *template.Template, data interface{}, dst string) error {
+	return b.write(dst, func(w io.Writer) error {
+		return t.Execute(w, data)
+	})
+}
+
+// write creates the file dst, and any missing directories, and fills it in
+// with f.
+func (b *Builder) write(dst string, f func(io.Writer) error) error {
+	b.writtenMutex.Lock()
+	b.written[dst] = true
+	b.writtenMutex.Unlock()
+	return writeAtomic(dst, f)
+}
+
+// writeAtomic fills in the file dst with f by way of a temp file, so that dst
+// is never seen, e.g. by piccolo serve, or left, partly written.
+func writeAtomic(dst string, f func(io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".piccolo-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := f(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// copyFile copies the file at src to dst.
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeAtomic(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+// LoadIncludes loads all the include files into a TemplateData.
+func (b *Builder) LoadIncludes() (*TemplateData, error) {
+	d := b.d
+	headerStr, _, err := Include(d, "header.html", "head")
+	if err != nil {
+		return nil, fmt.Errorf("Error loading header: %v", err)
+	}
+	inlineCss := ""
+	if b.c.InlineCSS != "" {
+		inlineCss, _, err = SimpleInclude(d, b.c.InlineCSS)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading inline CSS: %v", err)
+		}
+	}
+	footerStr, _, err := Include(d, "footer.html", "body")
+	if err != nil {
+		return nil, fmt.Errorf("Error loading footer: %v", err)
+	}
+	titlebarStr, _, err := Include(d, "titlebar.html", "body")
+	if err != nil {
+		return nil, fmt.Errorf("Error loading titlebar: %v", err)
+	}
+
+	highlightCss := ""
+	if b.c.Highlight.Classes {
+		if highlightCss, err = HighlightCSS(b.c.Highlight); err != nil {
+			return nil, fmt.Errorf("Error loading highlight CSS: %v", err)
+		}
+	}
+
+	data := &TemplateData{
+		Domain:       b.c.Domain,
+		SiteTitle:    b.c.SiteTitle,
+		Author:       b.c.Author,
+		Header:       headerStr,
+		InlineCSS:    inlineCss,
+		HighlightCSS: highlightCss,
+		Titlebar:     titlebarStr,
+		Footer:       footerStr,
+	}
+	return data, nil
+}
+
+// entryDepsHash returns the hash of everything, other than the source file
+// itself, that goes into an expanded entry: the config, the entry template,
+// the includes and the LaTex header.
+func (b *Builder) entryDepsHash() (string, error) {
+	root := b.d.Root
+	paths := []string{
+		filepath.Join(root, "tpl", b.c.Templates.Entry),
+		filepath.Join(root, "inc", "header.html"),
+		filepath.Join(root, "inc", "footer.html"),
+		filepath.Join(root, "inc", "titlebar.html"),
+		filepath.Join(root, "tex2im_header"),
+	}
+	if b.c.InlineCSS != "" {
+		paths = append(paths, filepath.Join(root, b.c.InlineCSS))
+	}
+	files, err := hashFiles(paths...)
+	if err != nil {
+		return "", err
+	}
+	config, err := json.Marshal(b.c)
+	if err != nil {
+		return "", err
+	}
+	return hashStrings(files, string(config)), nil
+}
+
+// workItem is a single file found by the walk that needs processing.
+type workItem struct {
+	path string
+	dest string
+	attr Attr
+}
+
+// workResult is the result of processing a workItem.
+type workResult struct {
+	entry    *Entry
+	included bool
+	verbatim bool
+	held     bool
+	warnings []string
+
+	// manifest records how dest was produced, if anything was produced.
+	manifest *ManifestEntry
+}
+
+// jobs returns the number of goroutines to use.
+func (b *Builder) jobs() int {
+	if b.Jobs > 0 {
+		return b.Jobs
+	}
+	return runtime.NumCPU()
+}
+
+// parallel calls f for every i in [0, n) using at most b.jobs() goroutines,
+// and returns the error with the lowest i, so that the error reported doesn't
+// depend on scheduling.
+func (b *Builder) parallel(ctx context.Context, n int, f func(i int) error) error {
+	errs := make([]error, n)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < b.jobs(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				errs[i] = f(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upToDate returns true if the output rel, built from inputs with the given
+// hash, exists along with the files written with it, and was built from the
+// same inputs last time.
+func (b *Builder) upToDate(rel, hash string) bool {
+	prev, ok := b.manifest.Outputs[rel]
+	if !ok || prev.Hash != hash {
+		return false
+	}
+	for _, path := range append([]string{rel}, prev.Files...) {
+		if _, err := os.Stat(filepath.Join(b.d.Root, path)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// entryFiles are the files written by the transforms of an entry.
+type entryFiles struct {
+	// contents of the files, indexed by URL.
+	contents map[string][]byte
+
+	// paths of the files, relative to the root.
+	paths []string
+}
+
+// writeFileFunc returns the WriteFileFunc given to transforms, which writes
+// files into the output directory and records them in files.
+func (b *Builder) writeFileFunc(files *entryFiles) WriteFileFunc {
+	files.contents = map[string][]byte{}
+	return func(name string, contents []byte) (string, error) {
+		u := "/" + path.Clean(name)
+		if _, ok := files.contents[u]; ok {
+			return u, nil
+		}
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return "", fmt.Errorf("File %q is outside the output directory.", name)
+		}
+		rel := filepath.Join(b.c.Output, filepath.FromSlash(name))
+		dst := filepath.Join(b.d.Root, rel)
+		// Entries written in parallel can refer to the same file, which
+		// only the first of them writes.
+		b.writtenMutex.Lock()
+		claimed := b.written[dst]
+		b.written[dst] = true
+		b.writtenMutex.Unlock()
+		if !claimed {
+			// The name depends on the contents, so if it exists it's
+			// already up to date.
+			if _, err := os.Stat(dst); err != nil {
+				if err := writeAtomic(dst, func(w io.Writer) error {
+					_, err := w.Write(contents)
+					return err
+				}); err != nil {
+					return "", err
+				}
+			}
+		}
+		files.contents[u] = contents
+		files.paths = append(files.paths, rel)
+		return u, nil
+	}
+}
+
+// process expands or copies a single file, if its inputs have changed since
+// the last build.
+func (b *Builder) process(ctx context.Context, item *workItem, templates *Templates, site *TemplateData, depsHash string) (*workResult, error) {
+	res := &workResult{}
+	src, err := filepath.Rel(b.d.Root, item.path)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(b.d.Root, item.dest)
+	if err != nil {
+		return nil, err
+	}
+	if IsEntry(item.path, item.attr) {
+		// Saving may add the created time, so hash afterwards.
+		fileinfo, err := entryInfoSaved(item.path, b.dollars())
+		if err != nil {
+			return nil, err
+		}
+		if (fileinfo.Draft && !b.Drafts) || fileinfo.Created.After(b.now()) {
+			b.logf("HELD:     %v\n", item.path)
+			res.held = true
+			return res, nil
+		}
+		srcHash, err := hashFiles(item.path)
+		if err != nil {
+			return nil, err
+		}
+		url, err := b.d.URL(item.path)
+		if err != nil {
+			return nil, err
+		}
+		if fileinfo.Slug != "" {
+			url = path.Join(path.Dir(url), fileinfo.Slug)
+			item.dest = filepath.Join(filepath.Dir(item.dest), fileinfo.Slug+".html")
+			if rel, err = filepath.Rel(b.d.Root, item.dest); err != nil {
+				return nil, err
+			}
+		}
+		res.entry = &Entry{
+			Path:       item.path,
+			Title:      fileinfo.Title,
+			URL:        url,
+			Tags:       fileinfo.Tags,
+			Categories: fileinfo.Categories,
+			Summary:    fileinfo.Summary,
+			Author:     fileinfo.Author,
+			Draft:      fileinfo.Draft,
+			Meta:       fileinfo.Meta,
+			Created:    fileinfo.Created,
+			Updated:    fileinfo.Updated,
+			text:       BodyText(fileinfo.Body()),
+		}
+		res.manifest = &ManifestEntry{
+			Source: src,
+			Hash:   hashStrings(srcHash, depsHash),
+		}
+		if !b.upToDate(rel, res.manifest.Hash) {
+			b.logf("INCLUDE:  %v\n", item.dest)
+			files := &entryFiles{}
+			res.warnings = append(res.warnings, b.transform(WithWriteFile(ctx, b.writeFileFunc(files)), fileinfo)...)
+			res.manifest.Files = files.paths
+
+			// Use the site data for template expansion, but with only this entry in it.
+			data := *site
+			data.Entries = []*Entry{res.entry}
+			if err := b.setBody(res.entry, fileinfo.Body(), files); err != nil {
+				return nil, err
+			}
+			if err := b.expand(templates.EntryHTML, &data, item.dest); err != nil {
+				return nil, err
+			}
+			res.included = true
+		} else {
+			res.manifest.Files = b.manifest.Outputs[rel].Files
+		}
+	}
+	if item.attr.Has(VERBATIM) {
+		srcHash, err := hashFiles(item.path)
+		if err != nil {
+			return nil, err
+		}
+		res.manifest = &ManifestEntry{
+			Source: src,
+			Hash:   srcHash,
+		}
+		if !b.upToDate(rel, srcHash) {
+			b.logf("VERBATIM: %v\n", item.dest)
+			if err := copyFile(item.dest, item.path); err != nil {
+				return nil, err
+			}
+			res.verbatim = true
+		}
+	}
+	return res, nil
+}
+
+// prune removes every file in the output directory that isn't in expected,
+// along with any directories left empty, and returns the paths of the
+// removed files. If DryRun is set then nothing is removed.
+func (b *Builder) prune(expected map[string]bool) ([]string, error) {
+	output := filepath.Join(b.d.Root, b.c.Output)
+	removed := []string{}
+	dirs := []string{}
+	walker := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == output {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path != output {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if expected[path] {
+			return nil
+		}
+		removed = append(removed, path)
+		if b.DryRun {
+			b.logf("ORPHAN:   %v\n", path)
+			return nil
+		}
+		b.logf("REMOVE:   %v\n", path)
+		return os.Remove(path)
+	}
+	if err := filepath.Walk(output, walker); err != nil {
+		return nil, err
+	}
+	if !b.DryRun {
+		// Remove empty directories, deepest first. Removing a directory that
+		// isn't empty fails, which is fine.
+		for i := len(dirs) - 1; i >= 0; i-- {
+			if entries, err := os.ReadDir(dirs[i]); err == nil && len(entries) == 0 {
+				os.Remove(dirs[i])
+			}
+		}
+	}
+	return removed, nil
+}
+
+// Build builds the site, copying and expanding every file in the DocSet whose
+// inputs have changed since the last build, as recorded in the manifest, then
+// writing the archive, main page and feed. Drafts, unless Drafts is set, and
+// entries created in the future are left out. Finally any files in the output
+// directory that weren't produced by the build, e.g. outputs of deleted or
+// ignored sources, are pruned.
+//
+// The files are processed in parallel, see Jobs, but the results, including
+// which error is returned, are the same as processing them in order.
+func (b *Builder) Build(ctx context.Context) (*BuildReport, error) {
+	d := b.d
+	templates, err := LoadTemplates(d.Root, b.c)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := b.LoadIncludes()
+	if err != nil {
+		return nil, err
+	}
+	if b.transforms, err = LookupTransforms(b.c.Transforms); err != nil {
+		return nil, err
+	}
+	depsHash, err := b.entryDepsHash()
+	if err != nil {
+		return nil, err
+	}
+	b.written = map[string]bool{}
+	b.listed = nil
+	manifestPath := filepath.Join(d.Root, ManifestFilename)
+	b.manifest, err = LoadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+
+	output := filepath.Join(d.Root, b.c.Output)
+
+	// Walk the docset and collect all the files that may need to be copied
+	// over, possibly transformed.
+	items := []*workItem{}
+	walker := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		attr, err := d.Path(path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && (attr.Has(IGNORE) || path == output) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !attr.Has(INCLUDE|VERBATIM) {
+			return nil
+		}
+		dest, err := b.dest(path)
+		if IsEntry(path, attr) {
+			dest, err = b.entryDest(path)
+		}
+		if err != nil {
+			return err
+		}
+		items = append(items, &workItem{
+			path: path,
+			dest: dest,
+			attr: attr,
+		})
+		return nil
+	}
+	if err := filepath.Walk(d.Root, walker); err != nil {
+		return nil, fmt.Errorf("Error walking: %v", err)
+	}
+
+	results := make([]*workResult, len(items))
+	err = b.parallel(ctx, len(items), func(i int) error {
+		res, err := b.process(ctx, items[i], templates, data, depsHash)
+		if err != nil {
+			return fmt.Errorf("%s: %v", items[i].path, err)
+		}
+		results[i] = res
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BuildReport{Warnings: b.c.Deprecated()}
+	entries := make([]*Entry, 0)
+	manifest := NewManifest()
+	pages := []string{}
+	// sources are the source paths of the outputs, indexed by destination.
+	sources := map[string]string{}
+	for i, res := range results {
+		if res.manifest != nil {
+			if prev, ok := sources[items[i].dest]; ok {
+				return nil, fmt.Errorf("%s and %s are both published to %s.", prev, items[i].path, items[i].dest)
+			}
+			sources[items[i].dest] = items[i].path
+		}
+		if res.entry != nil {
+			entries = append(entries, res.entry)
+		}
+		if res.manifest != nil && !IsEntry(items[i].path, items[i].attr) && filepath.Ext(items[i].path) == ".html" {
+			pages = append(pages, items[i].path)
+		}
+		if res.included {
+			report.Included = append(report.Included, items[i].dest)
+		}
+		if res.verbatim {
+			report.Verbatim = append(report.Verbatim, items[i].dest)
+		}
+		if res.held {
+			report.Held = append(report.Held, items[i].path)
+		}
+		report.Warnings = append(report.Warnings, res.warnings...)
+		if res.manifest != nil {
+			rel, err := filepath.Rel(d.Root, items[i].dest)
+			if err != nil {
+				return nil, err
+			}
+			manifest.Outputs[rel] = *res.manifest
+		}
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("No entries found.")
+	}
+
+	sort.Stable(EntryByCreated(entries))
+	data.Entries = entries
+	report.Entries = entries
+
+	data.Updated = lastUpdated(entries)
+
+	archiveURL, err := b.dirURL(d.Archive)
+	if err != nil {
+		return nil, err
+	}
+	data.Years = Archive(entries, archiveURL)
+	if err := b.expandPage(templates.ArchiveHTML, data, d.Archive, "index.html"); err != nil {
+		return nil, fmt.Errorf("Error building archive: %v", err)
+	}
+
+	if b.c.YearArchives || b.c.MonthArchives {
+		if err := b.buildDateArchives(templates.ArchiveHTML, data, b.c.MonthArchives); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.buildIndex(ctx, templates.IndexHTML, data, entries); err != nil {
+		return nil, err
+	}
+
+	// Take the first FeedLen items from the list, expand the Body, then pass to templates.
+	latest := entries
+	if len(latest) > b.c.FeedLen {
+		latest = latest[:b.c.FeedLen]
+	}
+	if err := b.loadBodies(ctx, latest); err != nil {
+		return nil, err
+	}
+	if b.c.Domain == "" && len(b.feedFormats()) > 0 {
+		report.Warnings = append(report.Warnings, "No feeds written: \"domain\" must be set to build a feed.")
+	}
+	if err := b.writeFeed(data.SiteTitle, "/", d.Feed, latest); err != nil {
+		return nil, fmt.Errorf("Error building feed: %v", err)
+	}
+
+	data.Entries = entries
+	warnings, err := b.buildTags(ctx, templates, data, entries, sources)
+	if err != nil {
+		return nil, err
+	}
+	report.Warnings = append(report.Warnings, warnings...)
+
+	if b.c.Search {
+		if err := b.writeSearchIndex(entries); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.c.Sitemap {
+		if err := b.writeSitemap(data.Updated, entries, pages); err != nil {
+			return nil, err
+		}
+	}
+
+	expected := map[string]bool{}
+	for rel, m := range manifest.Outputs {
+		expected[filepath.Join(d.Root, rel)] = true
+		for _, file := range m.Files {
+			expected[filepath.Join(d.Root, file)] = true
+		}
+	}
+	for path := range b.written {
+		expected[path] = true
+	}
+	if report.Removed, err = b.prune(expected); err != nil {
+		return nil, err
+	}
+	if err := manifest.Save(manifestPath); err != nil {
+		return nil, err
+	}
+	b.manifest = manifest
+	return report, nil
+}
+
+// dollars returns true if the latex transform will look for LaTex between
+// dollar signs, which Markdown entries must then leave alone.
+func (b *Builder) dollars() bool {
+	if !b.c.LaTex.Dollars {
+		return false
+	}
+	for _, name := range b.c.Transforms {
+		if name == "latex" {
+			return true
+		}
+	}
+	return false
+}
+
+// transform applies the transforms to the entry, in order, and returns a
+// warning for each transform that fails.
+func (b *Builder) transform(ctx context.Context, fi *FileInfo) []string {
+	warnings := []string{}
+	ctx = WithConfig(WithDocSet(ctx, b.d), b.c)
+	for i, t := range b.transforms {
+		if err := t.Transform(ctx, fi); err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: Error in transform %q: %s", fi.Path, b.c.Transforms[i], err))
+		}
+	}
+	return warnings
+}
+
+// setBody fills in the Body of the entry from the nodes, and the FeedBody from
+// the nodes with all their URLs made absolute, and the files written by the
+// transforms inlined if the config asks for it. The nodes are modified.
+func (b *Builder) setBody(e *Entry, nodes []*html.Node, files *entryFiles) error {
+	e.Body = StrFromNodes(nodes)
+	e.FeedBody = e.Body
+	if b.c.LaTex.FeedDataURIs && len(files.contents) > 0 {
+		DataURIs(nodes, files.contents)
+		e.FeedBody = StrFromNodes(nodes)
+	}
+	if b.c.Domain == "" {
+		return nil
+	}
+	base, err := url.Parse(newFeed(b.c, "", "", "", nil).AbsURL(e.URL))
+	if err != nil {
+		return err
+	}
+	AbsoluteURLs(nodes, base)
+	e.FeedBody = StrFromNodes(nodes)
+	return nil
+}
+
+// loadBodies fills in the Body of the entries that don't have one yet, i.e.
+// that weren't expanded by this build.
+func (b *Builder) loadBodies(ctx context.Context, entries []*Entry) error {
+	return b.parallel(ctx, len(entries), func(i int) error {
+		e := entries[i]
+		if e.Body != "" {
+			return nil
+		}
+		fi, err := entryInfoSaved(e.Path, b.dollars())
+		if err != nil {
+			return err
+		}
+		// Any transform errors have already been reported by the walk.
+		files := &entryFiles{}
+		b.transform(WithWriteFile(ctx, b.writeFileFunc(files)), fi)
+		return b.setBody(e, fi.Body(), files)
+	})
+}
+
+// feedFormat is a format feeds can be written in.
+type feedFormat struct {
+	// name of the file the feed is written to.
+	name  string
+	write func(io.Writer, *Feed) error
+}
+
+// feedFormats returns the formats that are turned on in the config.
+func (b *Builder) feedFormats() []feedFormat {
+	formats := []feedFormat{}
+	if b.c.Feeds.Atom {
+		formats = append(formats, feedFormat{"index.atom", WriteAtom})
+	}
+	if b.c.Feeds.RSS {
+		formats = append(formats, feedFormat{"index.rss", WriteRSS})
+	}
+	if b.c.Feeds.JSON {
+		formats = append(formats, feedFormat{"feed.json", WriteJSONFeed})
+	}
+	return formats
+}
+
+// writeFeed writes the feed of the entries, in each of the feed formats, into
+// the target directory dir. The link is the relative URL of the page the feed
+// is for. Nothing is written if the domain isn't set, since feeds need
+// absolute URLs.
+func (b *Builder) writeFeed(title, link, dir string, entries []*Entry) error {
+	formats := b.feedFormats()
+	if len(formats) == 0 {
+		return nil
+	}
+	if b.c.Domain == "" {
+		// Build reports this once, as a warning.
+		return nil
+	}
+	if dir == "" {
+		dir = b.d.Root
+	}
+	dirURL, err := b.dirURL(dir)
+	if err != nil {
+		return err
+	}
+	for _, format := range formats {
+		dst, err := b.pageDest(dir, format.name)
+		if err != nil {
+			return err
+		}
+		f := newFeed(b.c, title, dirURL+format.name, link, entries)
+		if err := b.write(dst, func(w io.Writer) error {
+			return format.write(w, f)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pageDest returns the destination of the file name in the target directory
+// dir. Pages without a .maintarget, .archivetarget or .feedtarget go in the
+// root.
+func (b *Builder) pageDest(dir, name string) (string, error) {
+	if dir == "" {
+		dir = b.d.Root
+	}
+	return b.dest(filepath.Join(dir, name))
+}
+
+// expandPage expands the template with the given data into the file name in
+// the target directory dir.
+func (b *Builder) expandPage(t *template.Template, data interface{}, dir, name string) error {
+	dst, err := b.pageDest(dir, name)
+	if err != nil {
+		return err
+	}
+	return b.expand(t, data, dst)
+}
@@ -0,0 +1,802 @@
+package piccolo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSite copies the test1 site into a temp directory, so that builds don't
+// modify the source tree, and returns a DocSet for it.
+func testSite(t *testing.T) *DocSet {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get cwd: %v\n", err)
+	}
+	dir := t.TempDir()
+	if err := os.CopyFS(dir, os.DirFS(filepath.Join(cwd, "tests", "src", "test1"))); err != nil {
+		t.Fatalf("Failed to copy test site: %v\n", err)
+	}
+	d, err := NewDocSet(dir)
+	if err != nil {
+		t.Fatalf("Failed to build DocSet: %v\n", err)
+	}
+	return d
+}
+
+// readDest returns the contents of a file in the output directory.
+func readDest(t *testing.T, d *DocSet, rel string) string {
+	b, err := os.ReadFile(filepath.Join(d.Root, d.Config.Output, rel))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v\n", err)
+	}
+	return string(b)
+}
+
+func TestBuild(t *testing.T) {
+	d := testSite(t)
+	report, err := NewBuilder(d, d.Config).Build(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	if got, want := len(report.Entries), 3; got != want {
+		t.Fatalf("Wrong number of entries: Got %d, Want %d\n", got, want)
+	}
+	if got, want := report.Entries[0].URL, "/a/test-no-meta"; got != want {
+		t.Errorf("Entries not sorted newest first: Got %s, Want %s\n", got, want)
+	}
+	if got, want := report.Entries[2].URL, "/a/markdown"; got != want {
+		t.Errorf("Entries not sorted newest first: Got %s, Want %s\n", got, want)
+	}
+	if got, want := len(report.Included), 3; got != want {
+		t.Errorf("Wrong number of included files: Got %d, Want %d\n", got, want)
+	}
+
+	testCases := []struct {
+		Rel  string
+		Want string
+	}{
+		{"a/test.html", "<title>Test Site |  Title </title>"},
+		{"a/test.html", "<p>This is text.</p>"},
+		{"a/test.html", "<p class=permalink>2009-07-04</p>"},
+		{"archives/index.html", `<a href="/a/test">`},
+		{"archives/index.html", `<a href="/a/markdown">A Markdown Entry</a>`},
+		{"a/markdown.html", "<p>This is <em>Markdown</em>.</p>"},
+		{"a/markdown.html", `<p class="raw">`},
+		{"index.html", `<a href="/a/test-no-meta">`},
+		{"feed/index.atom", "<name>Joe Gregorio</name>"},
+		{"feed/index.atom", `<category term="test"></category>`},
+		{"feed/index.atom", `<summary type="text">A test entry.</summary>`},
+		{"feed/index.atom", `<id>tag:example.org,2009-07-04:/a/test</id>`},
+		{"feed/index.atom", `<link rel="self" type="application/atom+xml" href="https://example.org/feed/index.atom"></link>`},
+		{"feed/index.atom", "&lt;p&gt;This is text.&lt;/p&gt;"},
+		{"afile", ""},
+	}
+	for _, tc := range testCases {
+		if got := readDest(t, d, tc.Rel); !strings.Contains(got, tc.Want) {
+			t.Errorf("%s doesn't contain %q:\n%s\n", tc.Rel, tc.Want, got)
+		}
+	}
+
+	for _, rel := range []string{"c", "tpl", "inc", "piccolo.json", "a/markdown.md"} {
+		if _, err := os.Stat(filepath.Join(d.Root, d.Config.Output, rel)); !os.IsNotExist(err) {
+			t.Errorf("%s should not have been published.\n", rel)
+		}
+	}
+
+	// Nothing has changed so a second build shouldn't write any entries.
+	report, err = NewBuilder(d, d.Config).Build(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to rebuild: %v\n", err)
+	}
+	if len(report.Included) != 0 || len(report.Verbatim) != 0 {
+		t.Errorf("Rebuild wrote files: %v %v\n", report.Included, report.Verbatim)
+	}
+}
+
+func TestBuildCancelled(t *testing.T) {
+	d := testSite(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewBuilder(d, d.Config).Build(ctx); err == nil {
+		t.Fatalf("Build should have failed when cancelled.\n")
+	}
+}
+
+// pinTimes sets the modification time of every file in the site to the same
+// time, so that separate copies of a site build the same.
+func pinTimes(t *testing.T, d *DocSet) {
+	pinned := time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := filepath.Walk(d.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, pinned, pinned)
+	})
+	if err != nil {
+		t.Fatalf("Failed to pin times: %v\n", err)
+	}
+}
+
+func TestBuildParallelIsDeterministic(t *testing.T) {
+	serial := testSite(t)
+	pinTimes(t, serial)
+	b := NewBuilder(serial, serial.Config)
+	b.Jobs = 1
+	want, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+
+	parallel := testSite(t)
+	pinTimes(t, parallel)
+	b = NewBuilder(parallel, parallel.Config)
+	b.Jobs = 8
+	got, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+
+	if len(got.Entries) != len(want.Entries) {
+		t.Fatalf("Wrong number of entries: Got %d, Want %d\n", len(got.Entries), len(want.Entries))
+	}
+	for i := range want.Entries {
+		if got.Entries[i].URL != want.Entries[i].URL {
+			t.Errorf("Entry %d differs: Got %s, Want %s\n", i, got.Entries[i].URL, want.Entries[i].URL)
+		}
+	}
+	for _, rel := range []string{"index.html", "archives/index.html", "feed/index.atom", "a/test.html"} {
+		if readDest(t, parallel, rel) != readDest(t, serial, rel) {
+			t.Errorf("%s differs between serial and parallel builds.\n", rel)
+		}
+	}
+}
+
+func TestBuildIncremental(t *testing.T) {
+	d := testSite(t)
+	build := func() *BuildReport {
+		report, err := NewBuilder(d, d.Config).Build(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to build: %v\n", err)
+		}
+		return report
+	}
+	build()
+	test := filepath.Join(d.Root, "a", "test.html")
+	afile := filepath.Join(d.Root, "afile")
+
+	// Only changing the modification times doesn't cause a rebuild.
+	future := time.Now().Add(time.Hour)
+	for _, path := range []string{test, afile} {
+		if err := os.Chtimes(path, future, future); err != nil {
+			t.Fatalf("Failed to touch: %v\n", err)
+		}
+	}
+	if report := build(); len(report.Included) != 0 || len(report.Verbatim) != 0 {
+		t.Errorf("Touching files caused a rebuild: %v %v\n", report.Included, report.Verbatim)
+	}
+
+	// Changing the content does.
+	if err := os.WriteFile(afile, []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to write: %v\n", err)
+	}
+	if report := build(); len(report.Included) != 0 || len(report.Verbatim) != 1 {
+		t.Errorf("Wrong files rebuilt: %v %v\n", report.Included, report.Verbatim)
+	}
+
+	// Changing an include rebuilds every entry.
+	footer := filepath.Join(d.Root, "inc", "footer.html")
+	if err := os.WriteFile(footer, []byte("<html><body><p>New footer</p></body></html>"), 0644); err != nil {
+		t.Fatalf("Failed to write: %v\n", err)
+	}
+	if report := build(); len(report.Included) != 3 {
+		t.Errorf("Changing an include didn't rebuild all the entries: %v\n", report.Included)
+	}
+	if got := readDest(t, d, "a/test.html"); !strings.Contains(got, "New footer") {
+		t.Errorf("Entry wasn't rebuilt with the new footer:\n%s\n", got)
+	}
+
+	// Deleting a source removes its output.
+	if err := os.Remove(test); err != nil {
+		t.Fatalf("Failed to remove: %v\n", err)
+	}
+	report := build()
+	want := filepath.Join(d.Root, d.Config.Output, "a", "test.html")
+	if len(report.Removed) == 0 || report.Removed[0] != want {
+		t.Errorf("Wrong files removed: Got %v, Want %s first\n", report.Removed, want)
+	}
+	if _, err := os.Stat(want); !os.IsNotExist(err) {
+		t.Errorf("Output of deleted source still exists.\n")
+	}
+}
+
+func TestBuildPrunes(t *testing.T) {
+	d := testSite(t)
+	output := filepath.Join(d.Root, d.Config.Output)
+	orphans := []string{
+		filepath.Join(output, "old", "deleted.html"),
+		filepath.Join(output, "c", "ignored"),
+	}
+	for _, path := range orphans {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v\n", err)
+		}
+		if err := os.WriteFile(path, []byte("orphan"), 0644); err != nil {
+			t.Fatalf("Failed to write: %v\n", err)
+		}
+	}
+
+	b := NewBuilder(d, d.Config)
+	b.DryRun = true
+	report, err := b.Build(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	if got, want := strings.Join(report.Removed, " "), orphans[1]+" "+orphans[0]; got != want {
+		t.Errorf("Wrong orphans reported: Got %s, Want %s\n", got, want)
+	}
+	for _, path := range orphans {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Dry run removed %s\n", path)
+		}
+	}
+
+	report, err = NewBuilder(d, d.Config).Build(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	if got, want := len(report.Removed), 2; got != want {
+		t.Errorf("Wrong number of files removed: Got %d, Want %d\n", got, want)
+	}
+	for _, path := range append(orphans, filepath.Join(output, "old")) {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Failed to remove %s\n", path)
+		}
+	}
+	for _, rel := range []string{"index.html", "a/test.html", "afile"} {
+		if _, err := os.Stat(filepath.Join(output, rel)); err != nil {
+			t.Errorf("Pruned a real output %s: %v\n", rel, err)
+		}
+	}
+}
+
+func TestBuildSlug(t *testing.T) {
+	d := testSite(t)
+	src := `<html><head><title>Slugged</title><meta name="created" value="2010-01-01T00:00:00"><meta name="slug" content="pretty"></head><body></body></html>`
+	if err := os.WriteFile(filepath.Join(d.Root, "a", "ugly-name.html"), []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to write: %v\n", err)
+	}
+	report, err := NewBuilder(d, d.Config).Build(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	if got, want := report.Entries[0].URL, "/a/pretty"; got != want {
+		t.Errorf("Wrong URL: Got %s, Want %s\n", got, want)
+	}
+	if got := readDest(t, d, "a/pretty.html"); !strings.Contains(got, "Slugged") {
+		t.Errorf("Wrong content for slugged entry:\n%s\n", got)
+	}
+	if _, err := os.Stat(filepath.Join(d.Root, d.Config.Output, "a", "ugly-name.html")); !os.IsNotExist(err) {
+		t.Errorf("Slugged entry was published under its filename.\n")
+	}
+}
+
+func TestBuildDuplicateDest(t *testing.T) {
+	testCases := []struct {
+		Name string
+		Src  string
+	}{
+		{"test.md", "---\ntitle: Markdown\ncreated: 2010-01-01\n---\nText.\n"},
+		{"other.html", `<html><head><title>Other</title><meta name="created" value="2010-01-01T00:00:00"><meta name="slug" content="test"></head><body></body></html>`},
+	}
+	for _, tc := range testCases {
+		d := testSite(t)
+		path := filepath.Join(d.Root, "a", tc.Name)
+		if err := os.WriteFile(path, []byte(tc.Src), 0644); err != nil {
+			t.Fatalf("Failed to write: %v\n", err)
+		}
+		_, err := NewBuilder(d, d.Config).Build(context.Background())
+		if err == nil || !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), filepath.Join(d.Root, "a", "test.html")) {
+			t.Errorf("Wrong error for %s: Got %v, Want an error naming both sources\n", tc.Name, err)
+		}
+	}
+}
+
+func TestBuildTermDuplicateDest(t *testing.T) {
+	for _, rel := range []string{"tags/index.html", "tags/go/index.html", "tags/go/index.atom", "categories/programming/index.html"} {
+		d := testSite(t)
+		path := filepath.Join(d.Root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v\n", err)
+		}
+		if err := os.WriteFile(path, []byte("<p>Mine</p>"), 0644); err != nil {
+			t.Fatalf("Failed to write: %v\n", err)
+		}
+		_, err := NewBuilder(d, d.Config).Build(context.Background())
+		if err == nil || !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), filepath.Join(d.Root, d.Config.Output, rel)) {
+			t.Errorf("Wrong error for %s: Got %v, Want an error naming the source and destination\n", rel, err)
+		}
+	}
+}
+
+func TestBuildDraftsAndScheduled(t *testing.T) {
+	d := testSite(t)
+	entries := map[string]string{
+		"draft.html":  `<html><head><title>Draft</title><meta name="created" value="2010-01-01T00:00:00"><meta name="draft"></head><body></body></html>`,
+		"future.html": `<html><head><title>Future</title><meta name="created" value="2030-01-01T00:00:00"></head><body></body></html>`,
+	}
+	for name, src := range entries {
+		if err := os.WriteFile(filepath.Join(d.Root, "a", name), []byte(src), 0644); err != nil {
+			t.Fatalf("Failed to write: %v\n", err)
+		}
+	}
+	build := func(drafts bool, now time.Time) *BuildReport {
+		b := NewBuilder(d, d.Config)
+		b.Drafts = drafts
+		b.Now = func() time.Time { return now }
+		report, err := b.Build(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to build: %v\n", err)
+		}
+		return report
+	}
+	published := func(name string) bool {
+		_, err := os.Stat(filepath.Join(d.Root, d.Config.Output, "a", name))
+		return err == nil
+	}
+
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	report := build(false, now)
+	if got, want := len(report.Held), 2; got != want {
+		t.Errorf("Wrong number held: Got %d, Want %d\n", got, want)
+	}
+	if got, want := len(report.Entries), 3; got != want {
+		t.Errorf("Wrong number of entries: Got %d, Want %d\n", got, want)
+	}
+	if published("draft.html") || published("future.html") {
+		t.Errorf("Held entries were published.\n")
+	}
+	if index := readDest(t, d, "archives/index.html"); strings.Contains(index, "Draft") || strings.Contains(index, "Future") {
+		t.Errorf("Held entries appear in the archive:\n%s\n", index)
+	}
+
+	build(true, now)
+	if !published("draft.html") || published("future.html") {
+		t.Errorf("Drafts weren't published with Drafts set.\n")
+	}
+
+	// Once the time has passed the scheduled entry is published, and the
+	// draft is removed again.
+	build(false, time.Date(2031, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if published("draft.html") || !published("future.html") {
+		t.Errorf("Scheduled entry wasn't published once its time passed.\n")
+	}
+}
+
+func TestBuildTags(t *testing.T) {
+	d := testSite(t)
+	if _, err := NewBuilder(d, d.Config).Build(context.Background()); err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	cloud := readDest(t, d, "tags/index.html")
+	for _, want := range []string{`href="/tags/go/">go</a> (1)`, `href="/tags/test/">test</a> (1)`} {
+		if !strings.Contains(cloud, want) {
+			t.Errorf("Tag cloud missing %q:\n%s\n", want, cloud)
+		}
+	}
+	if got := readDest(t, d, "tags/markdown/index.html"); !strings.Contains(got, "/a/markdown") {
+		t.Errorf("Tag page missing entry:\n%s\n", got)
+	}
+	// markdown.md isn't in the main feed, so its body must be loaded for the
+	// tag feed.
+	if got := readDest(t, d, "tags/go/index.atom"); !strings.Contains(got, "raw") {
+		t.Errorf("Tag feed missing entry body:\n%s\n", got)
+	}
+	// Every tag page has its own date headings, even when the page before it
+	// was for entries from the same month.
+	for _, rel := range []string{"tags/html/index.html", "tags/test/index.html"} {
+		if got := readDest(t, d, rel); !strings.Contains(got, "<td><i><b>2009</b></i></td>") {
+			t.Errorf("%s missing year heading:\n%s\n", rel, got)
+		}
+	}
+	// Categories get pages and feeds the same way.
+	if got := readDest(t, d, "categories/index.html"); !strings.Contains(got, `href="/categories/programming/">programming</a> (1)`) {
+		t.Errorf("Category list missing category:\n%s\n", got)
+	}
+	if got := readDest(t, d, "categories/programming/index.html"); !strings.Contains(got, "In programming") {
+		t.Errorf("Category page wrong:\n%s\n", got)
+	}
+	readDest(t, d, "categories/programming/index.atom")
+
+	// Removing the optional templates stops the tag pages being built, and
+	// the stale ones get pruned, but the tag feeds remain.
+	for _, name := range []string{"tag.html", "tags.html"} {
+		if err := os.Remove(filepath.Join(d.Root, "tpl", name)); err != nil {
+			t.Fatalf("Failed to remove template: %v\n", err)
+		}
+	}
+	if _, err := NewBuilder(d, d.Config).Build(context.Background()); err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	for _, rel := range []string{"tags/index.html", "tags/go/index.html"} {
+		if _, err := os.Stat(filepath.Join(d.Root, d.Config.Output, rel)); !os.IsNotExist(err) {
+			t.Errorf("Tag page %s wasn't pruned.\n", rel)
+		}
+	}
+	readDest(t, d, "tags/go/index.atom")
+}
+
+func TestBuildPaginated(t *testing.T) {
+	d := testSite(t)
+	d.Config.PageLen = 1
+	d.Config.YearArchives = true
+	if _, err := NewBuilder(d, d.Config).Build(context.Background()); err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	testCases := []struct {
+		rel   string
+		title string
+		want  []string
+		avoid []string
+	}{
+		{"index.html", "test-no-meta", []string{"Page 1 of 3", `rel=next href="/page/2/"`}, []string{"rel=prev"}},
+		{"page/2/index.html", "/a/test\"", []string{"Page 2 of 3", `rel=prev href="/"`, `rel=next href="/page/3/"`}, nil},
+		{"page/3/index.html", "/a/markdown", []string{"Page 3 of 3", `rel=prev href="/page/2/"`}, []string{"rel=next"}},
+	}
+	for _, tc := range testCases {
+		got := readDest(t, d, tc.rel)
+		for _, want := range append(tc.want, tc.title) {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s missing %q:\n%s\n", tc.rel, want, got)
+			}
+		}
+		for _, avoid := range tc.avoid {
+			if strings.Contains(got, avoid) {
+				t.Errorf("%s shouldn't contain %q:\n%s\n", tc.rel, avoid, got)
+			}
+		}
+	}
+
+	got := readDest(t, d, "archives/2009/index.html")
+	for _, want := range []string{"Archives for 2009", "/a/markdown", "/a/test-no-meta"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Year archive missing %q:\n%s\n", want, got)
+		}
+	}
+
+	// Without pagination there is only one page.
+	d.Config.PageLen = 0
+	report, err := NewBuilder(d, d.Config).Build(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	if got := readDest(t, d, "index.html"); !strings.Contains(got, "Page 1 of 1") {
+		t.Errorf("Wrong unpaginated index:\n%s\n", got)
+	}
+	if len(report.Removed) == 0 {
+		t.Errorf("Old index pages weren't pruned.\n")
+	}
+}
+
+func TestBuildDateArchives(t *testing.T) {
+	d := testSite(t)
+	src := `<html><head><title>Older</title><meta name="created" value="2008-12-31T00:00:00"></head><body></body></html>`
+	if err := os.WriteFile(filepath.Join(d.Root, "a", "older.html"), []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to write: %v\n", err)
+	}
+	d.Config.MonthArchives = true
+	if _, err := NewBuilder(d, d.Config).Build(context.Background()); err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	testCases := []struct {
+		rel   string
+		want  []string
+		avoid []string
+	}{
+		{"archives/index.html", []string{`href="/archives/2009/">2009</a>`, `href="/archives/2009/07/">Jul</a>`, `href="/archives/2008/12/">Dec</a>`, "3 entries"}, nil},
+		{"archives/2009/index.html", []string{"Archives for 2009", "/a/markdown"}, []string{"/a/older"}},
+		{"archives/2009/07/index.html", []string{"Archives for Jul 2009", "/a/test-no-meta"}, []string{"/a/older"}},
+		{"archives/2008/index.html", []string{"/a/older"}, []string{"/a/markdown"}},
+		{"archives/2008/12/index.html", []string{"Archives for Dec 2008", "/a/older"}, []string{"/a/markdown"}},
+	}
+	for _, tc := range testCases {
+		got := readDest(t, d, tc.rel)
+		for _, want := range tc.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s missing %q:\n%s\n", tc.rel, want, got)
+			}
+		}
+		for _, avoid := range tc.avoid {
+			if strings.Contains(got, avoid) {
+				t.Errorf("%s shouldn't contain %q:\n%s\n", tc.rel, avoid, got)
+			}
+		}
+	}
+}
+
+func TestBuildFeedNeedsDomain(t *testing.T) {
+	d := testSite(t)
+	d.Config.Domain = ""
+	report, err := NewBuilder(d, d.Config).Build(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	if got, want := len(report.Warnings), 1; got != want {
+		t.Fatalf("Wrong number of warnings: Got %d, Want %d: %v\n", got, want, report.Warnings)
+	}
+	if !strings.Contains(report.Warnings[0], `"domain"`) {
+		t.Errorf("Warning doesn't name \"domain\": %s\n", report.Warnings[0])
+	}
+	for _, rel := range []string{"feed/index.atom", "tags/go/index.atom"} {
+		if _, err := os.Stat(filepath.Join(d.Root, d.Config.Output, rel)); !os.IsNotExist(err) {
+			t.Errorf("Feed %s was written without a domain.\n", rel)
+		}
+	}
+	readDest(t, d, "index.html")
+}
+
+func TestBuildFeedFormats(t *testing.T) {
+	d := testSite(t)
+	d.Config.Feeds = FeedFormats{RSS: true, JSON: true}
+	if _, err := NewBuilder(d, d.Config).Build(context.Background()); err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	if _, err := os.Stat(filepath.Join(d.Root, d.Config.Output, "feed", "index.atom")); !os.IsNotExist(err) {
+		t.Errorf("Atom feed was written when turned off.\n")
+	}
+	// Both feeds have the same entries in the same order.
+	rss := readDest(t, d, "feed/index.rss")
+	feed := readDest(t, d, "feed/feed.json")
+	for _, f := range []string{rss, feed} {
+		first, second := strings.Index(f, ":/a/test-no-meta"), strings.Index(f, "2009-07-04:/a/test")
+		if first == -1 || second == -1 || first > second {
+			t.Errorf("Wrong entries:\n%s\n", f)
+		}
+		if strings.Contains(f, "/a/markdown") {
+			t.Errorf("Feed has more than feed_len entries:\n%s\n", f)
+		}
+	}
+	readDest(t, d, "tags/go/feed.json")
+}
+
+func TestBuildFeedAbsoluteURLs(t *testing.T) {
+	d := testSite(t)
+	src := `<html><head><title>Links</title><meta name="created" value="2010-01-01T00:00:00"></head><body><a href="/a/test">a</a><img src="pic.png"></body></html>`
+	if err := os.WriteFile(filepath.Join(d.Root, "a", "links.html"), []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to write: %v\n", err)
+	}
+	if _, err := NewBuilder(d, d.Config).Build(context.Background()); err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	feed := readDest(t, d, "feed/index.atom")
+	for _, want := range []string{"href=&#34;https://example.org/a/test&#34;", "src=&#34;https://example.org/a/pic.png&#34;"} {
+		if !strings.Contains(feed, want) {
+			t.Errorf("Feed missing %q:\n%s\n", want, feed)
+		}
+	}
+	for _, rel := range []string{"a/links.html", "index.html"} {
+		if got := readDest(t, d, rel); !strings.Contains(got, `<img src="pic.png"/>`) || strings.Contains(got, "https://example.org/a/pic.png") {
+			t.Errorf("URLs rewritten on the site in %s:\n%s\n", rel, got)
+		}
+	}
+}
+
+func TestBuildSitemap(t *testing.T) {
+	d := testSite(t)
+	files := map[string]string{
+		"about.html":   `<html><body>About</body></html>`,
+		"a/draft.html": `<html><head><title>Draft</title><meta name="created" value="2010-01-01T00:00:00"><meta name="draft"></head><body></body></html>`,
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(d.Root, name), []byte(src), 0644); err != nil {
+			t.Fatalf("Failed to write: %v\n", err)
+		}
+	}
+	d.Config.Sitemap = true
+	d.Config.Robots = true
+	d.Config.PageLen = 1
+	d.Config.MonthArchives = true
+	if _, err := NewBuilder(d, d.Config).Build(context.Background()); err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	sitemap := readDest(t, d, "sitemap.xml")
+	for _, want := range []string{
+		"<loc>https://example.org/</loc>",
+		"<loc>https://example.org/archives/</loc>",
+		"<loc>https://example.org/a/test</loc>\n    <lastmod>",
+		"<loc>https://example.org/a/markdown</loc>",
+		"<loc>https://example.org/about</loc>",
+		"<loc>https://example.org/page/2/</loc>\n    <lastmod>",
+		"<loc>https://example.org/archives/2009/</loc>",
+		"<loc>https://example.org/archives/2009/07/</loc>",
+		"<loc>https://example.org/tags/</loc>",
+		"<loc>https://example.org/tags/go/</loc>",
+		"<loc>https://example.org/categories/</loc>",
+		"<loc>https://example.org/categories/programming/</loc>",
+	} {
+		if !strings.Contains(sitemap, want) {
+			t.Errorf("Sitemap missing %q:\n%s\n", want, sitemap)
+		}
+	}
+	for _, avoid := range []string{"draft", "header", "/c/"} {
+		if strings.Contains(sitemap, avoid) {
+			t.Errorf("Sitemap shouldn't contain %q:\n%s\n", avoid, sitemap)
+		}
+	}
+	if got, want := readDest(t, d, "robots.txt"), "Sitemap: https://example.org/sitemap.xml\n"; !strings.Contains(got, want) {
+		t.Errorf("Wrong robots.txt: Got %q, Want %q\n", got, want)
+	}
+
+	// A robots.txt in the source isn't overwritten.
+	if err := os.WriteFile(filepath.Join(d.Root, "robots.txt"), []byte("User-agent: *\n"), 0644); err != nil {
+		t.Fatalf("Failed to write: %v\n", err)
+	}
+	if _, err := NewBuilder(d, d.Config).Build(context.Background()); err == nil || !strings.Contains(err.Error(), `"robots"`) {
+		t.Errorf("Wrong error: Got %v, Want an error naming \"robots\"\n", err)
+	}
+}
+
+func TestBuildSearchIndex(t *testing.T) {
+	d := testSite(t)
+	d.Config.Search = true
+	if _, err := NewBuilder(d, d.Config).Build(context.Background()); err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	index, err := LoadSearchIndex(filepath.Join(d.Root, d.Config.Output, SearchIndexFilename))
+	if err != nil {
+		t.Fatalf("Failed to load search index: %v\n", err)
+	}
+	if got, want := len(index.Docs), 3; got != want {
+		t.Fatalf("Wrong number of docs: Got %d, Want %d\n", got, want)
+	}
+	results := Search(index, "markdown")
+	if len(results) == 0 || results[0].URL != "/a/markdown" {
+		t.Errorf("Wrong results: Got %v\n", results)
+	}
+}
+
+func TestBuildTransforms(t *testing.T) {
+	d := testSite(t)
+	d.Config.Transforms = []string{"test-second", "test-first", "test-fail"}
+	report, err := NewBuilder(d, d.Config).Build(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	// Transforms are applied in the configured order, to the entry pages and
+	// to the feeds.
+	for _, rel := range []string{"a/test.html", "feed/index.atom"} {
+		got := readDest(t, d, rel)
+		second, first := strings.Index(got, "second"), strings.Index(got, "first")
+		if second == -1 || first == -1 || second > first {
+			t.Errorf("Transforms not applied in order to %s:\n%s\n", rel, got)
+		}
+	}
+	if got, want := len(report.Warnings), 3; got != want {
+		t.Errorf("Wrong number of warnings: Got %d, Want %d: %v\n", got, want, report.Warnings)
+	} else if !strings.Contains(report.Warnings[0], `"test-fail"`) {
+		t.Errorf("Warning doesn't name the transform: %s\n", report.Warnings[0])
+	}
+}
+
+func TestBuildHighlight(t *testing.T) {
+	d := testSite(t)
+	src := "---\ntitle: Code\ncreated: 2010-01-01\n---\n```go\nfunc main() {}\n```\n"
+	if err := os.WriteFile(filepath.Join(d.Root, "a", "code.md"), []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to write: %v\n", err)
+	}
+	d.Config.Transforms = []string{"highlight"}
+	d.Config.Highlight.Classes = true
+	if _, err := NewBuilder(d, d.Config).Build(context.Background()); err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	for _, rel := range []string{"a/code.html", "feed/index.atom"} {
+		if got := readDest(t, d, rel); !strings.Contains(got, "chroma") {
+			t.Errorf("Code not highlighted in %s:\n%s\n", rel, got)
+		}
+	}
+}
+
+func TestBuildLaTexExternal(t *testing.T) {
+	d := testSite(t)
+	pic := fakeRender("x^2", ".png")
+	src := `<html><head><title>Math</title><meta name="created" value="2010-01-01T00:00:00"></head><body><latex-pic>x^2</latex-pic></body></html>`
+	if err := os.WriteFile(filepath.Join(d.Root, "a", "math.html"), []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to write: %v\n", err)
+	}
+	d.Config.LaTex = LaTexConfig{Renderer: "fake", External: true, FeedDataURIs: true}
+	build := func() *BuildReport {
+		report, err := NewBuilder(d, d.Config).Build(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to build: %v\n", err)
+		}
+		if len(report.Warnings) != 0 {
+			t.Errorf("Unexpected warnings: %v\n", report.Warnings)
+		}
+		return report
+	}
+	build()
+	name := "latex/" + hashStrings(string(pic))[:16] + ".png"
+	if got, want := readDest(t, d, "a/math.html"), `<img src="/`+name+`" alt="x^2" title="x^2" width="30" height="12"/>`; !strings.Contains(got, want) {
+		t.Errorf("Entry doesn't refer to the image %q:\n%s\n", want, got)
+	}
+	if got := readDest(t, d, name); got != string(pic) {
+		t.Errorf("Image not written to %s\n", name)
+	}
+	if got, want := readDest(t, d, "feed/index.atom"), "src=&#34;data:image/png;base64,"; !strings.Contains(got, want) {
+		t.Errorf("Feed doesn't inline the image %q:\n%s\n", want, got)
+	}
+
+	// The image isn't pruned when the entry is up to date, and is rewritten if
+	// it goes missing.
+	if report := build(); len(report.Included) != 0 || len(report.Removed) != 0 {
+		t.Errorf("Wrong files rebuilt or removed: %v %v\n", report.Included, report.Removed)
+	}
+	if err := os.Remove(filepath.Join(d.Root, d.Config.Output, name)); err != nil {
+		t.Fatalf("Failed to remove: %v\n", err)
+	}
+	if report := build(); len(report.Included) != 1 {
+		t.Errorf("Missing image didn't rebuild the entry: %v\n", report.Included)
+	}
+	if got := readDest(t, d, name); got != string(pic) {
+		t.Errorf("Image not rewritten to %s\n", name)
+	}
+}
+
+func TestWriteFileFuncParallel(t *testing.T) {
+	d := testSite(t)
+	b := NewBuilder(d, d.Config)
+	b.written = map[string]bool{}
+	contents := fakeRender("x^2", ".png")
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = b.writeFileFunc(&entryFiles{})("latex/x.png", contents)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Failed to write: %v\n", err)
+		}
+	}
+	if got := readDest(t, d, "latex/x.png"); got != string(contents) {
+		t.Errorf("Wrong contents written.\n")
+	}
+	// No temp files are left behind.
+	files, err := os.ReadDir(filepath.Join(d.Root, d.Config.Output, "latex"))
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v\n", err)
+	}
+	if got, want := len(files), 1; got != want {
+		t.Errorf("Wrong number of files: Got %d, Want %d\n", got, want)
+	}
+}
+
+func TestBuildLaTexDollars(t *testing.T) {
+	d := testSite(t)
+	src := "---\ntitle: Math\ncreated: 2010-01-01\n---\nSo $x^2$, $a*b*c$, \\$z\\$ and `$y$`.\n"
+	if err := os.WriteFile(filepath.Join(d.Root, "a", "math.md"), []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to write: %v\n", err)
+	}
+	d.Config.LaTex = LaTexConfig{Renderer: "fake", Dollars: true}
+	report, err := NewBuilder(d, d.Config).Build(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	if len(report.Warnings) != 0 {
+		t.Errorf("Unexpected warnings: %v\n", report.Warnings)
+	}
+	got := readDest(t, d, "a/math.html")
+	for _, want := range []string{`alt="x^2" title="x^2" width="30" height="12" style="vertical-align: middle"/>`, `alt="a*b*c"`, " $z$ and ", "<code>$y$</code>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Entry doesn't contain %q:\n%s\n", want, got)
+		}
+	}
+}
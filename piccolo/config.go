@@ -0,0 +1,246 @@
+package piccolo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigFilename is the name of the site configuration file. It lives in the
+// same directory as the .root file.
+const ConfigFilename = "piccolo.json"
+
+// TemplateNames are the filenames of the templates, relative to the tpl
+// directory, used to build the site.
+type TemplateNames struct {
+	Index   string `json:"index"`
+	Archive string `json:"archive"`
+	Entry   string `json:"entry"`
+
+	// The tag templates are optional, tag pages are only built if they exist.
+	Tag  string `json:"tag"`
+	Tags string `json:"tags"`
+
+	// Atom and TagAtom are deprecated and have no effect, as feeds are no
+	// longer written from templates. They are kept so old configs still load.
+	Atom    string `json:"atom,omitempty"`
+	TagAtom string `json:"tag_atom,omitempty"`
+}
+
+// FeedFormats turns each of the feed formats on or off. Every feed is written
+// in each of the formats that is on, from the same entries.
+type FeedFormats struct {
+	// Atom 1.0, written to index.atom.
+	Atom bool `json:"atom"`
+
+	// RSS 2.0, written to index.rss.
+	RSS bool `json:"rss"`
+
+	// JSON Feed 1.1, written to feed.json.
+	JSON bool `json:"json"`
+}
+
+// Config is the site configuration loaded from ConfigFilename.
+type Config struct {
+	// SiteTitle is the title of the whole site.
+	SiteTitle string `json:"site_title"`
+
+	// Domain is the absolute URL the site will be served from, e.g.
+	// "https://bitworking.org/".
+	Domain string `json:"domain"`
+
+	// Author is the name of the author of the site.
+	Author string `json:"author"`
+
+	// FeedLen is the number of entries that appear in the feed, and on the
+	// main page if PageLen is 0.
+	FeedLen int `json:"feed_len"`
+
+	// PageLen is the number of entries on each page of the main index. If 0
+	// then the main index isn't paginated.
+	PageLen int `json:"page_len"`
+
+	// YearArchives turns on building an archive page for each year.
+	YearArchives bool `json:"year_archives"`
+
+	// MonthArchives turns on building an archive page for each year and each
+	// month.
+	MonthArchives bool `json:"month_archives"`
+
+	// Output is the directory, relative to the root, that the site is
+	// published into.
+	Output string `json:"output"`
+
+	// Templates are the names of the templates to use.
+	Templates TemplateNames `json:"templates"`
+
+	// Feeds are the formats the feeds are written in.
+	Feeds FeedFormats `json:"feeds"`
+
+	// Sitemap turns on writing sitemap.xml into the output directory.
+	Sitemap bool `json:"sitemap"`
+
+	// Robots turns on writing a robots.txt, that points at the sitemap, into
+	// the output directory.
+	Robots bool `json:"robots"`
+
+	// Search turns on writing a search index of the entries into the output
+	// directory.
+	Search bool `json:"search"`
+
+	// Transforms are the names of the transforms applied to every entry, in
+	// order, see RegisterTransform.
+	Transforms []string `json:"transforms"`
+
+	// Highlight controls the highlight transform.
+	Highlight HighlightConfig `json:"highlight"`
+
+	// LaTex controls the latex transform.
+	LaTex LaTexConfig `json:"latex"`
+
+	// InlineCSS is the file, relative to the root, whose contents are made
+	// available to the templates as InlineCSS. May be empty.
+	InlineCSS string `json:"inline_css"`
+}
+
+// DefaultConfig returns the Config used when no config file is present, and
+// which supplies the values for any keys missing from a config file. The site
+// title and domain are the ones piccolo had built in before it had a config.
+func DefaultConfig() *Config {
+	return &Config{
+		SiteTitle: "BitWorking",
+		Domain:    "https://bitworking.org/",
+		FeedLen:   4,
+		Output:    "dst",
+		InlineCSS: "out/prefixed.css",
+		Feeds: FeedFormats{
+			Atom: true,
+		},
+		Transforms: []string{"latex"},
+		Templates: TemplateNames{
+			Index:   "index.html",
+			Archive: "archive.html",
+			Entry:   "entry.html",
+			Tag:     "tag.html",
+			Tags:    "tags.html",
+		},
+	}
+}
+
+// reserved are the directories below the root that can't be used for output.
+var reserved = []string{"tpl", "inc", "tmp", ".git"}
+
+// Validate returns an error naming the first invalid key in the Config.
+func (c *Config) Validate() error {
+	if c.Domain != "" {
+		u, err := url.Parse(c.Domain)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("Invalid \"domain\": %q is not an absolute URL.", c.Domain)
+		}
+	}
+	if c.FeedLen <= 0 {
+		return fmt.Errorf("Invalid \"feed_len\": %d must be greater than 0.", c.FeedLen)
+	}
+	if c.Sitemap && c.Domain == "" {
+		return fmt.Errorf("Invalid \"sitemap\": needs \"domain\" to be set.")
+	}
+	if c.Robots && !c.Sitemap {
+		return fmt.Errorf("Invalid \"robots\": needs \"sitemap\" to be turned on.")
+	}
+	if _, err := LookupTransforms(c.Transforms); err != nil {
+		return fmt.Errorf("Invalid \"transforms\": %s", err)
+	}
+	if _, err := highlightStyle(c.Highlight.Style); err != nil {
+		return fmt.Errorf("Invalid \"highlight.style\": %s", err)
+	}
+	if _, err := LookupMathRenderer(c.LaTex.Renderer); err != nil {
+		return fmt.Errorf("Invalid \"latex.renderer\": %s", err)
+	}
+	if c.LaTex.FeedDataURIs && !c.LaTex.External {
+		return fmt.Errorf("Invalid \"latex.feed_data_uris\": needs \"latex.external\" to be turned on.")
+	}
+	if c.PageLen < 0 {
+		return fmt.Errorf("Invalid \"page_len\": %d must not be negative.", c.PageLen)
+	}
+	out := filepath.Clean(c.Output)
+	if c.Output == "" || out == "." || filepath.IsAbs(out) || strings.HasPrefix(out, "..") {
+		return fmt.Errorf("Invalid \"output\": %q must be a directory below the root.", c.Output)
+	}
+	for _, r := range reserved {
+		if out == r {
+			return fmt.Errorf("Invalid \"output\": %q is a reserved directory.", c.Output)
+		}
+	}
+	templates := []struct {
+		key   string
+		value string
+	}{
+		{"templates.index", c.Templates.Index},
+		{"templates.archive", c.Templates.Archive},
+		{"templates.entry", c.Templates.Entry},
+		{"templates.tag", c.Templates.Tag},
+		{"templates.tags", c.Templates.Tags},
+	}
+	for _, t := range templates {
+		if t.value == "" {
+			return fmt.Errorf("Invalid %q: must not be empty.", t.key)
+		}
+	}
+	return nil
+}
+
+// Deprecated returns a warning for each deprecated key that is set in the
+// Config.
+func (c *Config) Deprecated() []string {
+	warnings := []string{}
+	deprecated := []struct {
+		key   string
+		value string
+	}{
+		{"templates.atom", c.Templates.Atom},
+		{"templates.tag_atom", c.Templates.TagAtom},
+	}
+	for _, d := range deprecated {
+		if d.value != "" {
+			warnings = append(warnings, fmt.Sprintf("Deprecated %q: has no effect, feeds are no longer written from templates.", d.key))
+		}
+	}
+	return warnings
+}
+
+// ParseConfig reads a JSON encoded Config from r, filling in any missing keys
+// from DefaultConfig.
+func ParseConfig(r io.Reader) (*Config, error) {
+	c := DefaultConfig()
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("Failed to parse config: %s", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadConfig loads the Config from the given file. If the file doesn't exist
+// then DefaultConfig is returned.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := ParseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return c, nil
+}
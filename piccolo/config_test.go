@@ -0,0 +1,110 @@
+package piccolo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	testCases := []struct {
+		JSON string
+		Err  string
+	}{
+		{`{}`, ""},
+		{`{"site_title": "BitWorking", "domain": "https://bitworking.org/", "feed_len": 10}`, ""},
+		{`{"templates": {"entry": "post.html"}}`, ""},
+		{`{"domain": "bitworking.org"}`, `"domain"`},
+		{`{"feed_len": 0}`, `"feed_len"`},
+		{`{"page_len": -1}`, `"page_len"`},
+		{`{"feeds": {"rss": true, "json": true}}`, ""},
+		{`{"feeds": {"xml": true}}`, `"xml"`},
+		{`{"sitemap": false, "robots": true}`, `"robots"`},
+		{`{"sitemap": true, "domain": ""}`, `"sitemap"`},
+		{`{"sitemap": true, "robots": true, "domain": "https://bitworking.org/"}`, ""},
+		{`{"transforms": ["latex", "nope"]}`, `"transforms"`},
+		{`{"highlight": {"style": "nope"}}`, `"highlight.style"`},
+		{`{"latex": {"external": true, "feed_data_uris": true}}`, ""},
+		{`{"latex": {"feed_data_uris": true}}`, `"latex.feed_data_uris"`},
+		{`{"latex": {"renderer": "dvisvgm"}}`, ""},
+		{`{"latex": {"renderer": "nope"}}`, `"latex.renderer"`},
+		{`{"output": ""}`, `"output"`},
+		{`{"output": "../dst"}`, `"output"`},
+		{`{"output": "/tmp/dst"}`, `"output"`},
+		{`{"output": "tpl"}`, `"output"`},
+		{`{"templates": {"index": ""}}`, `"templates.index"`},
+		{`{"templates": {"atom": "index.atom", "tag_atom": "tag.atom"}}`, ""},
+		{`{"feed_length": 4}`, `"feed_length"`},
+		{`{"feed_len": "4"}`, `feed_len`},
+	}
+	for _, tc := range testCases {
+		_, err := ParseConfig(strings.NewReader(tc.JSON))
+		if tc.Err == "" {
+			if err != nil {
+				t.Errorf("Unexpected error for %s: %v\n", tc.JSON, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Expected error for %s\n", tc.JSON)
+		} else if !strings.Contains(err.Error(), tc.Err) {
+			t.Errorf("Error for %s doesn't name the key: Got %v, Want %s\n", tc.JSON, err, tc.Err)
+		}
+	}
+}
+
+func TestConfigDeprecated(t *testing.T) {
+	c, err := ParseConfig(strings.NewReader(`{"templates": {"atom": "index.atom"}}`))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v\n", err)
+	}
+	warnings := c.Deprecated()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `"templates.atom"`) {
+		t.Errorf("Wrong warnings: Got %v, Want one naming \"templates.atom\"\n", warnings)
+	}
+	if got := DefaultConfig().Deprecated(); len(got) != 0 {
+		t.Errorf("Unexpected warnings: %v\n", got)
+	}
+}
+
+func TestParseConfigDefaults(t *testing.T) {
+	c, err := ParseConfig(strings.NewReader(`{"templates": {"entry": "post.html"}}`))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v\n", err)
+	}
+	if got, want := c.Templates.Entry, "post.html"; got != want {
+		t.Errorf("Wrong entry template: Got %s, Want %s\n", got, want)
+	}
+	if got, want := c.Templates.Index, "index.html"; got != want {
+		t.Errorf("Wrong index template: Got %s, Want %s\n", got, want)
+	}
+	if got, want := c.Output, "dst"; got != want {
+		t.Errorf("Wrong output: Got %s, Want %s\n", got, want)
+	}
+}
+
+func TestDocSetConfig(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get cwd: %v\n", err)
+	}
+	a, err := NewDocSet(filepath.Join(cwd, "tests", "src", "test1", "a"))
+	if err != nil {
+		t.Fatalf("Failed to build DocSet: %v\n", err)
+	}
+	if got, want := a.Config.SiteTitle, "Test Site"; got != want {
+		t.Errorf("Wrong site title: Got %s, Want %s\n", got, want)
+	}
+	if got, want := a.Config.FeedLen, 2; got != want {
+		t.Errorf("Wrong feed len: Got %d, Want %d\n", got, want)
+	}
+
+	a, err = NewDocSet(filepath.Join(cwd, "tests", "src", "test2"))
+	if err != nil {
+		t.Fatalf("Failed to build DocSet: %v\n", err)
+	}
+	if got, want := a.Config.FeedLen, DefaultConfig().FeedLen; got != want {
+		t.Errorf("Wrong default feed len: Got %d, Want %d\n", got, want)
+	}
+}
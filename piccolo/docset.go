@@ -72,6 +72,9 @@ type DocSet struct {
 
 	// The directory where the Atom feed goes.
 	Feed string
+
+	// The site configuration.
+	Config *Config
 }
 
 // URL tranforms a src path into a relative URL.
@@ -80,10 +83,13 @@ func (a DocSet) URL(path string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	if strings.HasSuffix(rel, ".html") {
-		rel = rel[:len(rel)-5]
+	for _, ext := range []string{".html", ".md"} {
+		if strings.HasSuffix(rel, ext) {
+			rel = rel[:len(rel)-len(ext)]
+			break
+		}
 	}
-	return "/" + rel, nil
+	return "/" + filepath.ToSlash(rel), nil
 }
 
 // Dest tranforms a src path into a destination path.
@@ -92,7 +98,7 @@ func (a DocSet) Dest(path string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(a.Root, "dst", rel), nil
+	return filepath.Join(a.Root, a.Config.Output, rel), nil
 }
 
 // dirAttributes returns the attributes for a path.
@@ -189,9 +195,10 @@ func (a *DocSet) Path(path string) (Attr, error) {
 	return newattr, nil
 }
 
-// setKnownAttr makes our well-known directorys .ignore.
+// setKnownAttr makes our well-known directorys and files .ignore.
 func (a *DocSet) setKnownAttr() {
-	a.cache[filepath.Join(a.Root, "dst")] = IGNORE
+	a.cache[filepath.Join(a.Root, a.Config.Output)] = IGNORE
+	a.cache[filepath.Join(a.Root, ConfigFilename)] = IGNORE
 	a.cache[filepath.Join(a.Root, "tmp")] = IGNORE
 	a.cache[filepath.Join(a.Root, "tpl")] = IGNORE
 	a.cache[filepath.Join(a.Root, "inc")] = IGNORE
@@ -206,8 +213,11 @@ func NewDocSet(path string) (*DocSet, error) {
 	_, err := a.Path(path)
 	if err != nil {
 		return nil, err
-	} else {
-		a.setKnownAttr()
 	}
+	a.Config, err = LoadConfig(filepath.Join(a.Root, ConfigFilename))
+	if err != nil {
+		return nil, err
+	}
+	a.setKnownAttr()
 	return a, nil
 }
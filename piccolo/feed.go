@@ -0,0 +1,88 @@
+package piccolo
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Feed is a feed of entries, independent of the format it is written in.
+type Feed struct {
+	// Title of the feed.
+	Title string
+
+	// Domain is the absolute URL the site is served from, which all the other
+	// URLs are relative to.
+	Domain string
+
+	// Author of the feed, for entries that don't have their own author.
+	Author string
+
+	// URL is the relative URL of the feed itself.
+	URL string
+
+	// Link is the relative URL of the page the feed is for.
+	Link string
+
+	// Entries in the feed, newest first.
+	Entries []*Entry
+}
+
+// entryUpdated returns when the entry was last updated, which is never before
+// it was created.
+func entryUpdated(e *Entry) time.Time {
+	if e.Updated.Before(e.Created) {
+		return e.Created
+	}
+	return e.Updated
+}
+
+// lastUpdated returns the most recent time any of the entries was updated.
+func lastUpdated(entries []*Entry) time.Time {
+	var updated time.Time
+	for _, e := range entries {
+		if u := entryUpdated(e); u.After(updated) {
+			updated = u
+		}
+	}
+	return updated
+}
+
+// Updated returns the most recent time any entry in the feed was updated.
+func (f *Feed) Updated() time.Time {
+	return lastUpdated(f.Entries)
+}
+
+// AbsURL returns the absolute URL of a relative URL such as Entry.URL.
+func (f *Feed) AbsURL(rel string) string {
+	return strings.TrimSuffix(f.Domain, "/") + "/" + strings.TrimPrefix(rel, "/")
+}
+
+// EntryID returns a tag URI, see RFC 4151, that identifies the entry. It only
+// depends on the domain, creation date and URL of the entry, so it doesn't
+// change when the entry is edited.
+func (f *Feed) EntryID(e *Entry) string {
+	return fmt.Sprintf("tag:%s,%s:%s", f.host(), e.Created.Format("2006-01-02"), e.URL)
+}
+
+// host returns the host name of the domain, e.g. "bitworking.org".
+func (f *Feed) host() string {
+	if u, err := url.Parse(f.Domain); err == nil {
+		return u.Hostname()
+	}
+	return ""
+}
+
+// newFeed returns a Feed of the entries with the site wide values filled in
+// from the config.
+func newFeed(c *Config, title, feedURL, link string, entries []*Entry) *Feed {
+	return &Feed{
+		Title:   title,
+		Domain:  c.Domain,
+		Author:  c.Author,
+		URL:     feedURL,
+		Link:    link,
+		Entries: entries,
+	}
+}
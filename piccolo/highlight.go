@@ -0,0 +1,236 @@
+package piccolo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"golang.org/x/net/html"
+)
+
+func init() {
+	RegisterTransform("highlight", TransformFunc(func(ctx context.Context, fi *FileInfo) error {
+		c := ConfigFromContext(ctx)
+		if c == nil {
+			c = DefaultConfig()
+		}
+		return Highlight(fi.Node, c.Highlight)
+	}))
+}
+
+// HighlightConfig controls syntax highlighting.
+type HighlightConfig struct {
+	// Style is the name of the color scheme, e.g. "github", the default, or
+	// "monokai".
+	Style string `json:"style"`
+
+	// Classes, if true, marks up the code with CSS classes instead of inline
+	// styles. The CSS for the classes is available to templates as
+	// HighlightCSS.
+	Classes bool `json:"classes"`
+}
+
+// languagePrefixes are the class name prefixes that give the language of a
+// code block.
+var languagePrefixes = []string{"language-", "lang-"}
+
+// codeLanguage returns the language of a code block from the class of the
+// node, e.g. "go" from class="language-go", or "" if there isn't one.
+func codeLanguage(n *html.Node) string {
+	class, err := getAttrByName(n, "class")
+	if err != nil {
+		return ""
+	}
+	for _, c := range strings.Fields(class) {
+		for _, prefix := range languagePrefixes {
+			if strings.HasPrefix(c, prefix) {
+				return strings.TrimPrefix(c, prefix)
+			}
+		}
+	}
+	return ""
+}
+
+// codeAttr returns the value of the attribute on either the pre or the code
+// element of a code block.
+func codeAttr(pre, code *html.Node, name string) (string, bool) {
+	for _, n := range []*html.Node{code, pre} {
+		if v, err := getAttrByName(n, name); err == nil {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// parseLineRanges parses a list of lines and ranges of lines, e.g. "1,3-5".
+func parseLineRanges(s string) ([][2]int, error) {
+	ranges := [][2]int{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid line %q.", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(strings.TrimSpace(to)); err != nil || end < start {
+				return nil, fmt.Errorf("Invalid line range %q.", part)
+			}
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges, nil
+}
+
+// textOf returns the text inside the node.
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// highlightOptions returns the formatter options for a code block, from the
+// config and the attributes of the block:
+//
+//	data-line-numbers      Show line numbers, starting from the value if it
+//	                       has one.
+//	data-highlight="1,3-5" Highlight the given lines, numbered as they are
+//	                       shown.
+func highlightOptions(pre, code *html.Node, c HighlightConfig) ([]chromahtml.Option, error) {
+	options := []chromahtml.Option{chromahtml.WithClasses(c.Classes)}
+	if v, ok := codeAttr(pre, code, "data-line-numbers"); ok {
+		options = append(options, chromahtml.WithLineNumbers(true))
+		if v != "" {
+			start, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid data-line-numbers %q.", v)
+			}
+			options = append(options, chromahtml.BaseLineNumber(start))
+		}
+	}
+	if v, ok := codeAttr(pre, code, "data-highlight"); ok {
+		ranges, err := parseLineRanges(v)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, chromahtml.HighlightLines(ranges))
+	}
+	return options, nil
+}
+
+// defaultHighlightStyle is used if the config doesn't name a style.
+const defaultHighlightStyle = "github"
+
+// highlightStyle returns the named style, or the default style if name is
+// empty.
+func highlightStyle(name string) (*chroma.Style, error) {
+	if name == "" {
+		name = defaultHighlightStyle
+	}
+	style, ok := styles.Registry[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown highlight style %q.", name)
+	}
+	return style, nil
+}
+
+// Highlight finds code blocks, <pre><code class="language-go">, in the html
+// and replaces them with syntax highlighted HTML. Code blocks in languages
+// that aren't known are left alone. If any block fails to highlight the html
+// isn't changed at all.
+func Highlight(node *html.Node, c HighlightConfig) error {
+	style, err := highlightStyle(c.Style)
+	if err != nil {
+		return err
+	}
+	blocks := [][2]*html.Node{}
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "pre" {
+			code := n.FirstChild
+			for code != nil && code.Type == html.TextNode && strings.TrimSpace(code.Data) == "" {
+				code = code.NextSibling
+			}
+			if code != nil && code.Type == html.ElementNode && code.Data == "code" {
+				blocks = append(blocks, [2]*html.Node{n, code})
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(node)
+
+	// Highlight every block before replacing any of them, so an error
+	// doesn't leave the html half highlighted.
+	replacements := map[*html.Node][]*html.Node{}
+	for _, block := range blocks {
+		pre, code := block[0], block[1]
+		lang := codeLanguage(code)
+		if lang == "" {
+			lang = codeLanguage(pre)
+		}
+		lexer := lexers.Get(lang)
+		if lang == "" || lexer == nil {
+			continue
+		}
+		options, err := highlightOptions(pre, code, c)
+		if err != nil {
+			return err
+		}
+		iterator, err := chroma.Coalesce(lexer).Tokenise(nil, textOf(code))
+		if err != nil {
+			return fmt.Errorf("Failed to tokenize %s code: %s", lang, err)
+		}
+		var buf bytes.Buffer
+		if err := chromahtml.New(options...).Format(&buf, style, iterator); err != nil {
+			return fmt.Errorf("Failed to highlight %s code: %s", lang, err)
+		}
+		nodes, err := html.ParseFragment(&buf, pre.Parent)
+		if err != nil {
+			return err
+		}
+		replacements[pre] = nodes
+	}
+	for pre, nodes := range replacements {
+		for _, n := range nodes {
+			pre.Parent.InsertBefore(n, pre)
+		}
+		pre.Parent.RemoveChild(pre)
+	}
+	return nil
+}
+
+// HighlightCSS returns the CSS for the classes used by Highlight when
+// HighlightConfig.Classes is true.
+func HighlightCSS(c HighlightConfig) (string, error) {
+	style, err := highlightStyle(c.Style)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&buf, style); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
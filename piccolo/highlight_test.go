@@ -0,0 +1,115 @@
+package piccolo
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestParseLineRanges(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want [][2]int
+		err  bool
+	}{
+		{"1", [][2]int{{1, 1}}, false},
+		{"1, 3-5", [][2]int{{1, 1}, {3, 5}}, false},
+		{"", [][2]int{}, false},
+		{"a", nil, true},
+		{"5-3", nil, true},
+	}
+	for _, tc := range testCases {
+		got, err := parseLineRanges(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Errorf("Expected error for %q\n", tc.in)
+			}
+			continue
+		}
+		if err != nil || len(got) != len(tc.want) {
+			t.Errorf("Wrong ranges for %q: Got %v %v, Want %v\n", tc.in, got, err, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("Wrong ranges for %q: Got %v, Want %v\n", tc.in, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	testCases := []struct {
+		src    string
+		config HighlightConfig
+		want   []string
+		avoid  []string
+	}{
+		{
+			src:   `<pre><code class="language-go">func main() {}</code></pre>`,
+			want:  []string{`<pre style="`, `func</span>`},
+			avoid: []string{"language-go"},
+		},
+		{
+			src:    `<pre><code class="language-go">x := 1</code></pre>`,
+			config: HighlightConfig{Classes: true},
+			want:   []string{`<span class="nx">x</span>`},
+			avoid:  []string{`style="`},
+		},
+		{
+			src:    "<pre data-line-numbers=\"10\"><code class=\"lang-python\" data-highlight=\"11\">a = 1\nb = 2\n</code></pre>",
+			config: HighlightConfig{Classes: true},
+			want:   []string{`<span class="ln">10</span>`, `<span class="ln">11</span>`, `<span class="line hl">`},
+		},
+		{
+			src:  `<pre><code class="language-nosuchlanguage">a &lt; b</code></pre><pre>plain</pre>`,
+			want: []string{`<pre><code class="language-nosuchlanguage">a &lt; b</code></pre><pre>plain</pre>`},
+		},
+	}
+	for _, tc := range testCases {
+		doc, err := html.Parse(strings.NewReader("<html><body>" + tc.src + "</body></html>"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v\n", err)
+		}
+		if err := Highlight(doc, tc.config); err != nil {
+			t.Errorf("Failed to highlight %q: %v\n", tc.src, err)
+			continue
+		}
+		fi := FileInfo{Node: doc}
+		got := StrFromNodes(fi.Body())
+		for _, want := range tc.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("Highlighting %q missing %q:\n%s\n", tc.src, want, got)
+			}
+		}
+		for _, avoid := range tc.avoid {
+			if strings.Contains(got, avoid) {
+				t.Errorf("Highlighting %q shouldn't contain %q:\n%s\n", tc.src, avoid, got)
+			}
+		}
+	}
+
+	if err := Highlight(&html.Node{}, HighlightConfig{Style: "nosuchstyle"}); err == nil {
+		t.Errorf("Expected error for unknown style.\n")
+	}
+	if css, err := HighlightCSS(HighlightConfig{Style: "monokai"}); err != nil || !strings.Contains(css, ".chroma") {
+		t.Errorf("Wrong CSS: Got %q %v\n", css, err)
+	}
+}
+
+func TestHighlightErrorLeavesHTML(t *testing.T) {
+	src := `<pre><code class="language-go">x := 1</code></pre><pre data-highlight="3-1"><code class="language-go">y := 2</code></pre>`
+	doc, err := html.Parse(strings.NewReader("<html><body>" + src + "</body></html>"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v\n", err)
+	}
+	if err := Highlight(doc, HighlightConfig{}); err == nil {
+		t.Errorf("Expected an error for the bad data-highlight.\n")
+	}
+	// The good block before the bad one isn't highlighted either.
+	fi := FileInfo{Node: doc}
+	if got := StrFromNodes(fi.Body()); got != src {
+		t.Errorf("Got %v, Want %v\n", got, src)
+	}
+}
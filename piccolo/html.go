@@ -2,6 +2,7 @@ package piccolo
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"time"
 
@@ -26,8 +27,29 @@ type FileInfo struct {
 	// Time the source file was created.
 	Created time.Time
 
-	// Time the source file was last updated.
+	// Time the source file was last updated, or the value of the updated
+	// metadata if present.
 	Updated time.Time
+
+	// Meta is all the metadata, from the meta elements of an HTML entry or
+	// the front matter of a Markdown entry, indexed by name.
+	Meta map[string]string
+
+	// The tags and categories of the entry, from comma separated lists.
+	Tags       []string
+	Categories []string
+
+	// Summary is from the summary, or failing that description, metadata.
+	Summary string
+
+	// Author of the entry, if different from the site author.
+	Author string
+
+	// Draft entries are not published.
+	Draft bool
+
+	// Slug, if not empty, replaces the filename in the URL of the entry.
+	Slug string
 }
 
 // Body returns the parsed html.Node's in the body.
@@ -59,11 +81,21 @@ func getAttrByName(node *html.Node, name string) (string, error) {
 	return "", fmt.Errorf("Attribute %s not found.", name)
 }
 
+// metaValue returns the value of a meta element, which is in the value
+// attribute, or the standard content attribute.
+func metaValue(node *html.Node) (string, error) {
+	if value, err := getAttrByName(node, "value"); err == nil {
+		return value, nil
+	}
+	return getAttrByName(node, "content")
+}
+
 // CreationDate returns the time an HTML document was created.
 //
 // It also returns a FileInfo for the document, with the time added in the
-// header if it was missing. The bool returned is true the meta creation
-// element has been added to the header.
+// header if it was missing, and all the metadata from the meta elements. The
+// bool returned is true the meta creation element has been added to the
+// header.
 func CreationDate(path string) (*FileInfo, bool, error) {
 	title := ""
 	f, err := os.Open(path)
@@ -81,6 +113,7 @@ func CreationDate(path string) (*FileInfo, bool, error) {
 		return nil, false, err
 	}
 	hasMeta := false
+	metas := map[string]string{}
 	var head *html.Node
 	var found func(*html.Node)
 	var created time.Time
@@ -98,7 +131,12 @@ func CreationDate(path string) (*FileInfo, bool, error) {
 		if n.Type == html.ElementNode && n.Data == "meta" {
 			name, err := getAttrByName(n, "name")
 			if err == nil {
-				value, err := getAttrByName(n, "value")
+				value, err := metaValue(n)
+				if _, ok := metas[name]; ok && listKeys[name] {
+					metas[name] += ", " + value
+				} else {
+					metas[name] = value
+				}
 				if err == nil && name == "created" {
 					created, err = time.Parse(format, value)
 					if err != nil {
@@ -136,6 +174,9 @@ func CreationDate(path string) (*FileInfo, bool, error) {
 		Created: created,
 		Updated: stat.ModTime(),
 	}
+	if err := fi.applyMeta(metas); err != nil {
+		return nil, false, fmt.Errorf("%s: %s", path, err)
+	}
 	return fi, !hasMeta, nil
 }
 
@@ -161,3 +202,22 @@ func CreationDateSaved(path string) (*FileInfo, error) {
 	}
 	return fileinfo, err
 }
+
+// scaffold is the skeleton of a new entry.
+const scaffold = `<!DOCTYPE html>
+<html>
+  <head>
+    <title>%s</title>
+    <meta name="created" value="%s">
+  </head>
+  <body>
+  </body>
+</html>
+`
+
+// Scaffold writes the HTML for a new, empty, entry with the given title and
+// creation time.
+func Scaffold(w io.Writer, title string, created time.Time) error {
+	_, err := fmt.Fprintf(w, scaffold, html.EscapeString(title), created.Format(format))
+	return err
+}
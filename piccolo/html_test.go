@@ -39,3 +39,30 @@ func TestTransform(t *testing.T) {
 		}
 	}
 }
+
+func TestScaffold(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "new.html")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v\n", err)
+	}
+	created := time.Date(2014, time.March, 2, 10, 0, 0, 0, time.UTC)
+	if err := Scaffold(f, "Fish & Chips", created); err != nil {
+		t.Fatalf("Failed to write scaffold: %v\n", err)
+	}
+	f.Close()
+
+	fi, isNew, err := CreationDate(path)
+	if err != nil {
+		t.Fatalf("Failed to parse scaffold: %v\n", err)
+	}
+	if isNew {
+		t.Errorf("Scaffold is missing the created meta.\n")
+	}
+	if got, want := fi.Title, "Fish & Chips"; got != want {
+		t.Errorf("Title wrong: Got %v, Want %v\n", got, want)
+	}
+	if !fi.Created.Equal(created) {
+		t.Errorf("Created wrong: Got %v, Want %v\n", fi.Created, created)
+	}
+}
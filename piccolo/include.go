@@ -0,0 +1,93 @@
+package piccolo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// SimpleInclude loads the include file given the docset d.
+func SimpleInclude(d *DocSet, filename string) (string, time.Time, error) {
+	fullname := filepath.Join(d.Root, filename)
+
+	f, err := os.Open(fullname)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	t := stat.ModTime()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return string(b), t, nil
+}
+
+// Include loads the include file given the docset d.
+//
+// Returns the extracted HTML and the time the file was last modified.
+func Include(d *DocSet, filename, element string) (string, time.Time, error) {
+	fullname := filepath.Join(d.Root, "inc", filename)
+
+	f, err := os.Open(fullname)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	t := stat.ModTime()
+
+	doc, err := html.Parse(f)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var found func(*html.Node)
+	children := []*html.Node{}
+	found = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == element {
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				children = append(children, c)
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			found(c)
+		}
+	}
+	found(doc)
+	return StrFromNodes(children), t, nil
+}
+
+// Newest returns the most recent of all the times passed in.
+func Newest(times ...time.Time) time.Time {
+	newest := times[0]
+	for _, t := range times {
+		if t.After(newest) {
+			newest = t
+		}
+	}
+	return newest
+}
+
+// StrFromNodes returns the string of the rendered html.Nodes.
+func StrFromNodes(nodes []*html.Node) string {
+	buf := bytes.NewBuffer([]byte{})
+	for _, h := range nodes {
+		html.Render(buf, h)
+	}
+	return buf.String()
+}
@@ -0,0 +1,67 @@
+package piccolo
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// The objects of a JSON Feed 1.1, see https://www.jsonfeed.org/version/1.1/.
+
+type jsonFeed struct {
+	Version     string       `json:"version"`
+	Title       string       `json:"title"`
+	HomePageURL string       `json:"home_page_url"`
+	FeedURL     string       `json:"feed_url"`
+	Authors     []jsonAuthor `json:"authors,omitempty"`
+	Items       []jsonItem   `json:"items"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonItem struct {
+	ID            string       `json:"id"`
+	URL           string       `json:"url"`
+	Title         string       `json:"title"`
+	ContentHTML   string       `json:"content_html"`
+	Summary       string       `json:"summary,omitempty"`
+	DatePublished string       `json:"date_published"`
+	DateModified  string       `json:"date_modified"`
+	Authors       []jsonAuthor `json:"authors,omitempty"`
+	Tags          []string     `json:"tags,omitempty"`
+}
+
+// WriteJSONFeed writes the feed as JSON Feed 1.1.
+func WriteJSONFeed(w io.Writer, f *Feed) error {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.AbsURL(f.Link),
+		FeedURL:     f.AbsURL(f.URL),
+		Items:       []jsonItem{},
+	}
+	if f.Author != "" {
+		feed.Authors = []jsonAuthor{{Name: f.Author}}
+	}
+	for _, e := range f.Entries {
+		item := jsonItem{
+			ID:            f.EntryID(e),
+			URL:           f.AbsURL(e.URL),
+			Title:         e.Title,
+			ContentHTML:   e.FeedBody,
+			Summary:       e.Summary,
+			DatePublished: e.Created.Format(time.RFC3339),
+			DateModified:  entryUpdated(e).Format(time.RFC3339),
+			Tags:          append(append([]string{}, e.Tags...), e.Categories...),
+		}
+		if e.Author != "" {
+			item.Authors = []jsonAuthor{{Name: e.Author}}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(feed)
+}
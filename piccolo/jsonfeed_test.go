@@ -0,0 +1,42 @@
+package piccolo
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteJSONFeed(t *testing.T) {
+	f := testFeed()
+	f.URL = "/feed/feed.json"
+	var buf bytes.Buffer
+	if err := WriteJSONFeed(&buf, f); err != nil {
+		t.Fatalf("Failed to write feed: %v\n", err)
+	}
+	var got jsonFeed
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to parse feed: %v\n%s\n", err, buf.String())
+	}
+	if got.Version != "https://jsonfeed.org/version/1.1" {
+		t.Errorf("Wrong version: Got %s\n", got.Version)
+	}
+	if got.FeedURL != "https://example.org/feed/feed.json" || got.HomePageURL != "https://example.org/" {
+		t.Errorf("Wrong URLs: Got %s %s\n", got.FeedURL, got.HomePageURL)
+	}
+	if len(got.Authors) != 1 || got.Authors[0].Name != "Joe Gregorio" {
+		t.Errorf("Wrong authors: Got %v\n", got.Authors)
+	}
+	if got, want := len(got.Items), 2; got != want {
+		t.Fatalf("Wrong number of items: Got %d, Want %d\n", got, want)
+	}
+	newer, older := got.Items[0], got.Items[1]
+	if newer.ID != "tag:example.org,2009-07-05:/a/new" || newer.ContentHTML != f.Entries[0].FeedBody || newer.Summary != "Short." {
+		t.Errorf("Wrong item: Got %+v\n", newer)
+	}
+	if len(newer.Authors) != 1 || newer.Authors[0].Name != "Someone Else" {
+		t.Errorf("Wrong item authors: Got %v\n", newer.Authors)
+	}
+	if older.DatePublished != "2009-07-04T12:00:00Z" || older.DateModified != "2009-07-06T12:00:00Z" {
+		t.Errorf("Wrong item dates: Got %s %s\n", older.DatePublished, older.DateModified)
+	}
+}
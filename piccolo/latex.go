@@ -2,97 +2,451 @@ package piccolo
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
+	"encoding/xml"
 	"fmt"
-	"io/ioutil"
+	"image"
+	_ "image/png"
+	"math"
+	"mime"
 	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
-	"time"
+	"unicode"
+	"unicode/utf8"
 
-	"go.skia.org/infra/go/exec"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
-// LaTex finds <latex-pic> nodes in the html and
-// replaces them with PNG images of the rendered LaTex.
-func LaTex(node *html.Node, root string) error {
-	latexNodes := []*html.Node{}
-	var f func(*html.Node) error
-	f = func(n *html.Node) error {
-		if n.Type == html.ElementNode && n.Data == "latex-pic" {
-			// Create a tmp file to write the Latex code into.
-			file, err := ioutil.TempFile("/tmp", "piccolo-latex-")
-			if err != nil {
-				return fmt.Errorf("Couldn't create temp file: %s", err)
-			}
-			_, err = file.Write([]byte(n.FirstChild.Data))
-			if err != nil {
-				return fmt.Errorf("Failed to write file: %s", err)
+func init() {
+	RegisterTransform("latex", TransformFunc(func(ctx context.Context, fi *FileInfo) error {
+		d := DocSetFromContext(ctx)
+		if d == nil {
+			return fmt.Errorf("No docset to find the LaTex header in.")
+		}
+		c := ConfigFromContext(ctx)
+		r, err := LookupMathRenderer(c.LaTex.Renderer)
+		if err != nil {
+			return err
+		}
+		var write WriteFileFunc
+		if c.LaTex.External {
+			if write = WriteFileFromContext(ctx); write == nil {
+				return fmt.Errorf("No output to write the LaTex images to.")
 			}
-			file.Close()
-			defer os.Remove(file.Name())
-			// And create a tmp file to receive the PNG.
-			dest, err := ioutil.TempFile("/tmp", "piccolo-latex-")
-			if err != nil {
-				return fmt.Errorf("Couldn't create temp file: %s", err)
+		}
+		if c.LaTex.Dollars {
+			DollarMath(fi.Node)
+		}
+		return LaTex(fi.Node, d.Root, r, write)
+	}))
+}
+
+// LaTexConfig controls the latex transform.
+type LaTexConfig struct {
+	// Renderer is the name of the MathRenderer that renders the LaTex:
+	// "tex2im", the default, for PNGs, "dvisvgm" for SVGs, or "mathml" for
+	// MathML. See RegisterMathRenderer.
+	Renderer string `json:"renderer"`
+
+	// External, if true, writes the rendered LaTex images into LaTexDir in
+	// the output directory, named by their contents, instead of inlining them
+	// into the HTML as data URIs.
+	External bool `json:"external"`
+
+	// FeedDataURIs, if true, inlines the rendered LaTex into the feeds as data
+	// URIs even when External is true, so that feed readers don't have to
+	// fetch the images.
+	FeedDataURIs bool `json:"feed_data_uris"`
+
+	// Dollars, if true, also renders LaTex between dollar signs in the text,
+	// see DollarMath.
+	Dollars bool `json:"dollars"`
+}
+
+// LaTexDir is the directory, relative to the output directory, that rendered
+// LaTex is written into when LaTexConfig.External is true.
+const LaTexDir = "latex"
+
+// LaTexCacheDir is the directory, relative to the root, that rendered LaTex
+// is cached in.
+const LaTexCacheDir = "tmp/latex"
+
+// latexKey returns the key LaTex rendered by r is cached under, which covers
+// everything that goes into the rendering, including the options of r.
+func latexKey(root string, r MathRenderer, src string, inline bool) (string, error) {
+	header, err := hashFiles(filepath.Join(root, "tex2im_header"))
+	if err != nil {
+		return "", err
+	}
+	return hashStrings(fmt.Sprintf("%T", r), r.Ext(), r.Options(), header, strconv.FormatBool(inline), src), nil
+}
+
+// renderLaTex renders the LaTex src with r, inline or as a display, using the
+// cache under root if the same LaTex has been rendered before.
+func renderLaTex(root string, r MathRenderer, src string, inline bool) ([]byte, error) {
+	key, err := latexKey(root, r, src, inline)
+	if err != nil {
+		return nil, err
+	}
+	cached := filepath.Join(root, LaTexCacheDir, key+r.Ext())
+	if b, err := os.ReadFile(cached); err == nil {
+		return b, nil
+	}
+	b, err := r.Render(root, src, inline)
+	if err != nil {
+		return nil, err
+	}
+	// Write to a temp file then rename, so that parallel builders never see
+	// a partial file.
+	if err := os.MkdirAll(filepath.Dir(cached), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cached), key+".tmp-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), cached); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// dataURI returns a data URI of the contents b of a file with the given name,
+// the extension of which gives the media type.
+func dataURI(name string, b []byte) string {
+	mediaType := mime.TypeByExtension(path.Ext(name))
+	if i := strings.Index(mediaType, ";"); i != -1 {
+		mediaType = mediaType[:i]
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mediaType, base64.StdEncoding.EncodeToString(b))
+}
+
+// lengthPixels converts a length such as "12.5pt" into whole pixels, rounding
+// up.
+func lengthPixels(s string) (int, bool) {
+	units := []struct {
+		suffix string
+		pixels float64
+	}{
+		{"px", 1},
+		{"pt", 4.0 / 3},
+		{"", 1},
+	}
+	for _, u := range units {
+		if !strings.HasSuffix(s, u.suffix) {
+			continue
+		}
+		f, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+		if err != nil || f <= 0 {
+			return 0, false
+		}
+		return int(math.Ceil(f * u.pixels)), true
+	}
+	return 0, false
+}
+
+// svgAttrs are the attributes of the root element of an SVG.
+type svgAttrs struct {
+	Width  string `xml:"width,attr"`
+	Height string `xml:"height,attr"`
+	Style  string `xml:"style,attr"`
+}
+
+// imageSize returns the width and height in pixels of the image b, in the
+// format given by the extension ext, if it can be decoded.
+func imageSize(b []byte, ext string) (int, int, bool) {
+	if ext == ".svg" {
+		svg := svgAttrs{}
+		if err := xml.Unmarshal(b, &svg); err != nil {
+			return 0, 0, false
+		}
+		width, ok := lengthPixels(svg.Width)
+		height, ok2 := lengthPixels(svg.Height)
+		return width, height, ok && ok2
+	}
+	c, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return 0, 0, false
+	}
+	return c.Width, c.Height, true
+}
+
+// verticalAlign returns the CSS vertical-align that puts the baseline of the
+// inline math image b, in the format given by the extension ext, on the
+// baseline of the text. That's given by the style of SVGs, see MathRenderer,
+// otherwise the best that can be done is to center the image on the text.
+func verticalAlign(b []byte, ext string) string {
+	if ext == ".svg" {
+		svg := svgAttrs{}
+		if err := xml.Unmarshal(b, &svg); err == nil {
+			for _, decl := range strings.Split(svg.Style, ";") {
+				if name, value, ok := strings.Cut(decl, ":"); ok && strings.TrimSpace(name) == "vertical-align" {
+					return strings.TrimSpace(value)
+				}
 			}
-			dest.Close()
-			defer os.Remove(dest.Name())
-			// Convert the latex to a PNG with:
-			//
-			//   tex2im  -z -a -o ./dst/test.png test.tex
-			args := fmt.Sprintf("-z -a -r 100x100 -x %s/tex2im_header -o %s %s", root, dest.Name(), file.Name())
-			output := bytes.Buffer{}
-			err = exec.Run(&exec.Command{
-				Name:           "tex2im",
-				Args:           strings.Split(args, " "),
-				Env:            []string{},
-				CombinedOutput: &output,
-				Timeout:        10 * time.Minute,
-				InheritPath:    true,
-			})
+		}
+	}
+	return "middle"
+}
+
+// latexSrc returns the src of the rendered LaTex b, in the format given by the
+// extension ext. If write is nil then it is a data URI, otherwise the image is
+// written into LaTexDir, under a name that depends on its contents, and the
+// src is its URL.
+func latexSrc(b []byte, ext string, write WriteFileFunc) (string, error) {
+	name := hashStrings(string(b))[:16] + ext
+	if write == nil {
+		return dataURI(name, b), nil
+	}
+	return write(path.Join(LaTexDir, name), b)
+}
+
+// latexNodes returns the nodes that display the LaTex src rendered by r as b,
+// inline or as a display.
+func latexNodes(src string, b []byte, r MathRenderer, inline bool, write WriteFileFunc) ([]*html.Node, error) {
+	if r.Ext() == MathMLExt {
+		return html.ParseFragment(bytes.NewReader(b), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	}
+	imgSrc, err := latexSrc(b, r.Ext(), write)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create an img node.
+	imgNode := &html.Node{
+		Type: html.ElementNode,
+		Data: "img",
+		Attr: []html.Attribute{
+			html.Attribute{
+				Key: "src",
+				Val: imgSrc,
+			},
+			html.Attribute{
+				Key: "alt",
+				Val: src,
+			},
+			html.Attribute{
+				Key: "title",
+				Val: src,
+			},
+		},
+	}
+	// Give the size, so the page doesn't reflow as images load.
+	if width, height, ok := imageSize(b, r.Ext()); ok {
+		imgNode.Attr = append(imgNode.Attr,
+			html.Attribute{Key: "width", Val: strconv.Itoa(width)},
+			html.Attribute{Key: "height", Val: strconv.Itoa(height)},
+		)
+	}
+	if inline {
+		imgNode.Attr = append(imgNode.Attr, html.Attribute{Key: "style", Val: "vertical-align: " + verticalAlign(b, r.Ext())})
+	}
+	return []*html.Node{imgNode}, nil
+}
+
+// LaTex finds <latex-pic> nodes, for displays, and <latex-inline> nodes, for
+// math within a line of text, in the html and replaces them with the LaTex
+// rendered by r, either images or MathML. Inline math is aligned with the
+// baseline of the text.
+//
+// The images are inlined as data URIs, unless write is not nil, in which case
+// they are written out as files with it. Rendered LaTex is cached under
+// LaTexCacheDir in root, so each formula is only rendered once.
+func LaTex(node *html.Node, root string, r MathRenderer, write WriteFileFunc) error {
+	latexElements := []*html.Node{}
+	var f func(*html.Node) error
+	f = func(n *html.Node) error {
+		if n.Type == html.ElementNode && (n.Data == "latex-pic" || n.Data == "latex-inline") {
+			src := textOf(n)
+			inline := n.Data == "latex-inline"
+			b, err := renderLaTex(root, r, src, inline)
 			if err != nil {
-				return fmt.Errorf("Failed to run tex2im: %q %s", output, err)
+				return err
 			}
-			b, err := ioutil.ReadFile(dest.Name())
+			nodes, err := latexNodes(src, b, r, inline, write)
 			if err != nil {
-				return fmt.Errorf("Failed to read PNG: %s", err)
+				return err
 			}
-			uri := fmt.Sprintf("data:image/png;base64,%s", base64.StdEncoding.EncodeToString(b))
-
-			// Create an img node.
-			imgNode := &html.Node{
-				Type: html.ElementNode,
-				Data: "img",
-				Attr: []html.Attribute{
-					html.Attribute{
-						Key: "src",
-						Val: uri,
-					},
-					html.Attribute{
-						Key: "alt",
-						Val: n.FirstChild.Data,
-					},
-					html.Attribute{
-						Key: "title",
-						Val: n.FirstChild.Data,
-					},
-				},
+			// Insert them just before the latex element.
+			for _, c := range nodes {
+				n.Parent.InsertBefore(c, n)
 			}
-			// Insert it just before the latex-pic element.
-			n.Parent.InsertBefore(imgNode, n)
-			// Remove the original latex-pic element later.
-			latexNodes = append(latexNodes, n)
+			// Remove the original latex element later.
+			latexElements = append(latexElements, n)
+			return nil
 		}
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			f(c)
+			if err := f(c); err != nil {
+				return err
+			}
 		}
 		return nil
 	}
 	err := f(node)
-	for _, n := range latexNodes {
+	for _, n := range latexElements {
 		n.Parent.RemoveChild(n)
 	}
 	return err
 
 }
+
+// dollarSkip are the elements whose text DollarMath leaves alone.
+var dollarSkip = map[string]bool{
+	"head":         true,
+	"pre":          true,
+	"code":         true,
+	"kbd":          true,
+	"samp":         true,
+	"script":       true,
+	"style":        true,
+	"textarea":     true,
+	"math":         true,
+	"latex-pic":    true,
+	"latex-inline": true,
+}
+
+// dollarSpan is a piece of text split up by splitDollars.
+type dollarSpan struct {
+	text string
+
+	// element is the name of the element the text goes in if it is math, or
+	// "" if it's plain text.
+	element string
+}
+
+// closingDollar returns the index of the $ that closes the inline math that
+// starts at start in s, or -1 if there isn't one.
+func closingDollar(s string, start int) int {
+	if start >= len(s) {
+		return -1
+	}
+	if first, _ := utf8.DecodeRuneInString(s[start:]); unicode.IsSpace(first) {
+		return -1
+	}
+	for j := start; j < len(s); j++ {
+		if s[j] == '\\' {
+			j++
+			continue
+		}
+		if s[j] != '$' {
+			continue
+		}
+		before, _ := utf8.DecodeLastRuneInString(s[:j])
+		after, _ := utf8.DecodeRuneInString(s[j+1:])
+		if unicode.IsSpace(before) || unicode.IsDigit(after) {
+			return -1
+		}
+		return j
+	}
+	return -1
+}
+
+// closingDollars returns the index of the $$ that closes the display math that
+// starts at start in s, or -1 if there isn't one.
+func closingDollars(s string, start int) int {
+	for j := start; j < len(s); j++ {
+		if s[j] == '\\' {
+			j++
+			continue
+		}
+		if strings.HasPrefix(s[j:], "$$") {
+			return j
+		}
+	}
+	return -1
+}
+
+// splitDollars splits the text s into plain text and math, see DollarMath.
+func splitDollars(s string) []dollarSpan {
+	spans := []dollarSpan{}
+	text := strings.Builder{}
+	add := func(math, element string) {
+		if text.Len() > 0 {
+			spans = append(spans, dollarSpan{text: text.String()})
+			text.Reset()
+		}
+		spans = append(spans, dollarSpan{text: math, element: element})
+	}
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], `\$`) {
+			text.WriteByte('$')
+			i += 2
+		} else if strings.HasPrefix(s[i:], "$$") {
+			if end := closingDollars(s, i+2); end != -1 && strings.TrimSpace(s[i+2:end]) != "" {
+				add(s[i+2:end], "latex-pic")
+				i = end + 2
+			} else {
+				text.WriteString("$$")
+				i += 2
+			}
+		} else if s[i] == '$' {
+			if end := closingDollar(s, i+1); end != -1 {
+				add(s[i+1:end], "latex-inline")
+				i = end + 1
+			} else {
+				text.WriteByte('$')
+				i++
+			}
+		} else {
+			text.WriteByte(s[i])
+			i++
+		}
+	}
+	if text.Len() > 0 {
+		spans = append(spans, dollarSpan{text: text.String()})
+	}
+	return spans
+}
+
+// DollarMath finds LaTex between dollar signs in the text of the html and puts
+// it into elements for LaTex to render, <latex-inline> for $...$ and
+// <latex-pic> for $$...$$. Text in code, and other elements where dollar signs
+// aren't math, is left alone.
+//
+// As in Pandoc, the opening $ of inline math must be followed by a non-space,
+// and the closing $ must follow a non-space and not be followed by a digit, so
+// that "$5 and $10" isn't math. Otherwise a dollar sign can be escaped as \$.
+func DollarMath(node *html.Node) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && dollarSkip[n.Data] {
+			return
+		}
+		if n.Type == html.TextNode && strings.Contains(n.Data, "$") {
+			spans := splitDollars(n.Data)
+			if len(spans) == 1 && spans[0].element == "" && spans[0].text == n.Data {
+				return
+			}
+			for _, span := range spans {
+				c := &html.Node{Type: html.TextNode, Data: span.text}
+				if span.element != "" {
+					e := &html.Node{Type: html.ElementNode, Data: span.element}
+					e.AppendChild(c)
+					c = e
+				}
+				n.Parent.InsertBefore(c, n)
+			}
+			n.Parent.RemoveChild(n)
+			return
+		}
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			walk(c)
+			c = next
+		}
+	}
+	walk(node)
+}
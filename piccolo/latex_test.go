@@ -2,9 +2,14 @@ package piccolo
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
+	"image"
+	"image/png"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"golang.org/x/net/html"
@@ -12,25 +17,257 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestLaTex(t *testing.T) {
+// fakeRenderer is a MathRenderer that doesn't need TeX installed. It renders
+// LaTex as a blank image, or MathML, the size of which depends on the LaTex.
+type fakeRenderer struct {
+	ext     string
+	options string
+
+	// renders is the number of times Render has been called.
+	renders int32
+}
+
+func (f *fakeRenderer) Ext() string {
+	return f.ext
+}
+
+func (f *fakeRenderer) Options() string {
+	return f.options
+}
+
+func (f *fakeRenderer) Render(root, src string, inline bool) ([]byte, error) {
+	atomic.AddInt32(&f.renders, 1)
+	if inline && f.ext == ".svg" {
+		return svgBaseline(fakeRender(src, f.ext), "2.0pt"), nil
+	}
+	return fakeRender(src, f.ext), nil
+}
 
+// fakeRender returns what fakeRenderer renders src as, as a display.
+func fakeRender(src, ext string) []byte {
+	src = strings.TrimSpace(src)
+	switch ext {
+	case ".svg":
+		return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%dpt" height="9pt"></svg>`, 3*len(src)))
+	case MathMLExt:
+		return []byte(fmt.Sprintf("<math><mi>%s</mi></math>", html.EscapeString(src)))
+	}
+	buf := &bytes.Buffer{}
+	png.Encode(buf, image.NewGray(image.Rect(0, 0, 10*len(src), 12)))
+	return buf.Bytes()
+}
+
+func init() {
+	RegisterMathRenderer("fake", &fakeRenderer{ext: ".png"})
+}
+
+func TestLaTex(t *testing.T) {
 	cwd, err := os.Getwd()
 	if err != nil {
 		t.Fatalf("Failed to get cwd: %v\n", err)
 	}
 	testCases := []struct {
 		Filename string
+		Ext      string
+		Want     string
 	}{
-		{"latex1.html"},
+		{"latex1.html", ".png", `<img src="data:image/png;base64,`},
+		{"latex1.html", ".png", `alt="
+      E &amp;= mc^2
+    " title="
+      E &amp;= mc^2
+    " width="90" height="12"/>`},
+		{"latex1.html", ".svg", `<img src="data:image/svg+xml;base64,`},
+		{"latex1.html", ".svg", `width="36" height="12"/>`},
+		{"latex1.html", MathMLExt, "<math><mi>E &amp;= mc^2</mi></math>"},
 	}
 	for _, tc := range testCases {
 		path := filepath.Join(cwd, "tests", "src", tc.Filename)
 		fi, _, _ := CreationDate(path)
-		err := LaTex(fi.Node, ".")
+		err := LaTex(fi.Node, t.TempDir(), &fakeRenderer{ext: tc.Ext}, nil)
 		assert.NoError(t, err)
 		buf := bytes.NewBuffer([]byte{})
 		html.Render(buf, fi.Node)
-		fmt.Printf("converted:", buf.String())
-		assert.Contains(t, buf.String(), "<img src=\"data:image/png;base64,")
+		assert.Contains(t, buf.String(), tc.Want)
+		assert.NotContains(t, buf.String(), "latex-pic")
+	}
+}
+
+func TestLaTexCache(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "tex2im_header"), []byte(`\usepackage{amsmath}`), 0644); err != nil {
+		t.Fatalf("Failed to write header: %v\n", err)
+	}
+	r := &fakeRenderer{ext: ".png"}
+	key, err := latexKey(root, r, "x^2", false)
+	if err != nil {
+		t.Fatalf("Failed to get key: %v\n", err)
+	}
+
+	// Each formula is only rendered once, even across builds.
+	for i := 0; i < 2; i++ {
+		doc, err := html.Parse(strings.NewReader("<html><body><latex-pic>x^2</latex-pic><latex-pic>x^2</latex-pic></body></html>"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v\n", err)
+		}
+		if err := LaTex(doc, root, r, nil); err != nil {
+			t.Fatalf("Failed to expand LaTex: %v\n", err)
+		}
+	}
+	if got, want := r.renders, int32(1); got != want {
+		t.Errorf("Wrong number of renders: Got %d, Want %d\n", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(root, LaTexCacheDir, key+".png")); err != nil {
+		t.Errorf("Rendered LaTex not cached: %v\n", err)
+	}
+
+	// The key changes with the source, the renderer and its options, inline
+	// or display, and the header.
+	if other, _ := latexKey(root, r, "x^3", false); other == key {
+		t.Errorf("Key doesn't depend on the source.\n")
+	}
+	if other, _ := latexKey(root, &fakeRenderer{ext: ".svg"}, "x^2", false); other == key {
+		t.Errorf("Key doesn't depend on the renderer.\n")
+	}
+	if other, _ := latexKey(root, &fakeRenderer{ext: ".png", options: "-r 200x200"}, "x^2", false); other == key {
+		t.Errorf("Key doesn't depend on the options.\n")
+	}
+	if other, _ := latexKey(root, r, "x^2", true); other == key {
+		t.Errorf("Key doesn't depend on inline.\n")
+	}
+	if err := os.WriteFile(filepath.Join(root, "tex2im_header"), []byte(`\usepackage{amssymb}`), 0644); err != nil {
+		t.Fatalf("Failed to write header: %v\n", err)
+	}
+	if other, _ := latexKey(root, r, "x^2", false); other == key {
+		t.Errorf("Key doesn't depend on the header.\n")
+	}
+}
+
+func TestLaTexExternal(t *testing.T) {
+	pic := fakeRender("x^2", ".png")
+	doc, err := html.Parse(strings.NewReader("<html><body><latex-pic>x^2</latex-pic><p><latex-pic>x^2</latex-pic></p></body></html>"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v\n", err)
+	}
+	written := map[string][]byte{}
+	write := func(name string, b []byte) (string, error) {
+		written[name] = b
+		return "/" + name, nil
+	}
+	if err := LaTex(doc, t.TempDir(), &fakeRenderer{ext: ".png"}, write); err != nil {
+		t.Fatalf("Failed to expand LaTex: %v\n", err)
+	}
+	name := "latex/" + hashStrings(string(pic))[:16] + ".png"
+	if got, want := len(written), 1; got != want {
+		t.Fatalf("Wrong number of files written: Got %d, Want %d\n", got, want)
+	}
+	if !bytes.Equal(written[name], pic) {
+		t.Errorf("Image not written to %s: %v\n", name, written)
+	}
+	img := `<img src="/` + name + `" alt="x^2" title="x^2" width="30" height="12"/>`
+	fi := FileInfo{Node: doc}
+	if got, want := StrFromNodes(fi.Body()), img+"<p>"+img+"</p>"; got != want {
+		t.Errorf("Got %v, Want %v\n", got, want)
+	}
+}
+
+func TestImageSize(t *testing.T) {
+	testCases := []struct {
+		b      []byte
+		ext    string
+		width  int
+		height int
+		ok     bool
+	}{
+		{fakeRender("x^2", ".png"), ".png", 30, 12, true},
+		{[]byte(`<svg width="12.3pt" height="6pt"></svg>`), ".svg", 17, 8, true},
+		{[]byte(`<svg width="20px" height="10"></svg>`), ".svg", 20, 10, true},
+		{[]byte(`<svg width="2em" height="1em"></svg>`), ".svg", 0, 0, false},
+		{[]byte(`<svg></svg>`), ".svg", 0, 0, false},
+		{[]byte("PNG"), ".png", 0, 0, false},
+	}
+	for _, tc := range testCases {
+		width, height, ok := imageSize(tc.b, tc.ext)
+		if width != tc.width || height != tc.height || ok != tc.ok {
+			t.Errorf("Got %d %d %v, Want %d %d %v\n", width, height, ok, tc.width, tc.height, tc.ok)
+		}
+	}
+}
+
+func TestLaTexInline(t *testing.T) {
+	testCases := []struct {
+		Ext  string
+		Want string
+	}{
+		{".png", `<p>So <img src="data:image/png;base64,` + base64.StdEncoding.EncodeToString(fakeRender("x^2", ".png")) + `" alt="x^2" title="x^2" width="30" height="12" style="vertical-align: middle"/>.</p>`},
+		{".svg", `width="12" height="12" style="vertical-align: -2.0pt"/>.</p>`},
+		{MathMLExt, "<p>So <math><mi>x^2</mi></math>.</p>"},
+	}
+	for _, tc := range testCases {
+		doc, err := html.Parse(strings.NewReader("<html><body><p>So <latex-inline>x^2</latex-inline>.</p></body></html>"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v\n", err)
+		}
+		if err := LaTex(doc, t.TempDir(), &fakeRenderer{ext: tc.Ext}, nil); err != nil {
+			t.Fatalf("Failed to expand LaTex: %v\n", err)
+		}
+		fi := FileInfo{Node: doc}
+		if got := StrFromNodes(fi.Body()); !strings.HasSuffix(got, tc.Want) {
+			t.Errorf("Got %v, Want %v\n", got, tc.Want)
+		}
+	}
+}
+
+func TestVerticalAlign(t *testing.T) {
+	testCases := []struct {
+		b    string
+		ext  string
+		want string
+	}{
+		{`<svg style="vertical-align: -1.94444pt" width="9pt"></svg>`, ".svg", "-1.94444pt"},
+		{`<svg style="color: red;vertical-align:-2pt;"></svg>`, ".svg", "-2pt"},
+		{`<svg width="9pt"></svg>`, ".svg", "middle"},
+		{"PNG", ".png", "middle"},
+	}
+	for _, tc := range testCases {
+		if got := verticalAlign([]byte(tc.b), tc.ext); got != tc.want {
+			t.Errorf("Got %v, Want %v\n", got, tc.want)
+		}
+	}
+}
+
+func TestDollarMath(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want string
+	}{
+		{`<p>So $x^2$.</p>`, `<p>So <latex-inline>x^2</latex-inline>.</p>`},
+		{`<p>$$E = mc^2$$</p>`, `<p><latex-pic>E = mc^2</latex-pic></p>`},
+		{`<p>$a$ and $$b$$</p>`, `<p><latex-inline>a</latex-inline> and <latex-pic>b</latex-pic></p>`},
+		{`<p>From $5 to $10.</p>`, `<p>From $5 to $10.</p>`},
+		{`<p>A $ sign, and $ x$.</p>`, `<p>A $ sign, and $ x$.</p>`},
+		{`<p>Costs \$5, or $\$x$.</p>`, `<p>Costs $5, or <latex-inline>\$x</latex-inline>.</p>`},
+		{`<p>Empty $$$$.</p>`, `<p>Empty $$$$.</p>`},
+		{`<p>$à$ and $é $.</p>`, `<p><latex-inline>à</latex-inline> and $é $.</p>`},
+		{`<p>$x$à</p>`, `<p><latex-inline>x</latex-inline>à</p>`},
+		{`<p><em>$y$</em></p>`, `<p><em><latex-inline>y</latex-inline></em></p>`},
+		{`<pre><code>echo $HOME$</code></pre><p><code>$x$</code></p>`, `<pre><code>echo $HOME$</code></pre><p><code>$x$</code></p>`},
+		{`<latex-pic>$x$</latex-pic>`, `<latex-pic>$x$</latex-pic>`},
+	}
+	for _, tc := range testCases {
+		doc, err := html.Parse(strings.NewReader("<html><head><title>$t$</title></head><body>" + tc.in + "</body></html>"))
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v\n", tc.in, err)
+		}
+		DollarMath(doc)
+		fi := FileInfo{Node: doc}
+		if got := StrFromNodes(fi.Body()); got != tc.want {
+			t.Errorf("Got %v, Want %v\n", got, tc.want)
+		}
+		buf := &bytes.Buffer{}
+		html.Render(buf, doc)
+		if !strings.Contains(buf.String(), "<title>$t$</title>") {
+			t.Errorf("Title changed: %s\n", buf.String())
+		}
 	}
 }
@@ -0,0 +1,350 @@
+package piccolo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// ResolveURL returns the file in the output directory dst that serves the URL
+// path p, or "" if there is none. Since DocSet.URL drops the .html extension
+// the path may be the file itself, the file with .html added, or a directory
+// with an index.html.
+func ResolveURL(dst, p string) string {
+	name := filepath.Join(dst, filepath.FromSlash(path.Clean("/"+p)))
+	candidates := []string{name, name + ".html", filepath.Join(name, "index.html")}
+	for _, c := range candidates {
+		if info, err := os.Stat(c); err == nil && !info.IsDir() {
+			return c
+		}
+	}
+	return ""
+}
+
+// Link is a link from a generated page.
+type Link struct {
+	// Page is the generated file the link is in.
+	Page string
+
+	// Source is the source file the page was generated from, or "" for pages
+	// such as the main index that don't have a single source.
+	Source string
+
+	// Line is the line of Page the link is on.
+	Line int
+
+	// SourceLine is the line of Source the link is on, or 0 if it isn't
+	// there, e.g. for links that come from the templates.
+	SourceLine int
+
+	// URL is the link as it appears in the page.
+	URL string
+}
+
+// LinkProblem is a broken link.
+type LinkProblem struct {
+	Link
+
+	// Problem describes what is wrong with the link.
+	Problem string
+}
+
+// String returns the problem with the line of the source file the link is on
+// or, if the link isn't in a source file, the line of the built page.
+func (p LinkProblem) String() string {
+	if p.SourceLine > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", p.Source, p.SourceLine, p.URL, p.Problem)
+	}
+	s := fmt.Sprintf("%s:%d: %s: %s (line of the built page", p.Page, p.Line, p.URL, p.Problem)
+	if p.Source != "" {
+		s += fmt.Sprintf(", from %s", p.Source)
+	}
+	return s + ")"
+}
+
+// urlOpeners and urlClosers are the characters that can come before and after
+// a URL in HTML or Markdown source, e.g. the quotes of an attribute or the
+// parentheses of a Markdown link.
+const (
+	urlOpeners = "\"'(= \t"
+	urlClosers = "\"')> \t\r"
+)
+
+// sourceLines fills in the SourceLine of the links, from a page built from the
+// source src, by finding where their URLs appear in src. The nth link to a
+// URL is taken to be its nth appearance.
+func sourceLines(links []Link, src []byte) {
+	lines := bytes.Split(src, []byte("\n"))
+	seen := map[string]int{}
+	for i := range links {
+		u := links[i].URL
+		links[i].SourceLine = findURL(lines, u, seen[u])
+		seen[u]++
+	}
+}
+
+// findURL returns the line, counting from 1, of the nth appearance of the URL
+// u in lines, or of its first appearance if there are fewer, or 0 if it
+// doesn't appear at all.
+func findURL(lines [][]byte, u string, n int) int {
+	first := 0
+	for i, line := range lines {
+		for _, form := range []string{u, html.EscapeString(u)} {
+			count := countURL(line, form)
+			if count == 0 {
+				continue
+			}
+			if first == 0 {
+				first = i + 1
+			}
+			if n < count {
+				return i + 1
+			}
+			n -= count
+			break
+		}
+	}
+	return first
+}
+
+// countURL returns the number of times u appears in line as a whole URL.
+func countURL(line []byte, u string) int {
+	count := 0
+	for start := 0; u != ""; {
+		j := bytes.Index(line[start:], []byte(u))
+		if j == -1 {
+			break
+		}
+		j += start
+		end := j + len(u)
+		if (j == 0 || strings.IndexByte(urlOpeners, line[j-1]) != -1) && (end == len(line) || strings.IndexByte(urlClosers, line[end]) != -1) {
+			count++
+		}
+		start = j + 1
+	}
+	return count
+}
+
+// LinkReport is the result of CheckLinks.
+type LinkReport struct {
+	// Problems are the broken internal links.
+	Problems []LinkProblem
+
+	// External are all the links to other sites, which CheckLinks doesn't
+	// check, see CheckExternalLinks.
+	External []Link
+}
+
+// linkedPage is what CheckLinks needs to know about each generated page.
+type linkedPage struct {
+	links []Link
+
+	// ids are the anchors in the page, from id attributes and the name
+	// attributes of a elements.
+	ids map[string]bool
+}
+
+// parsePage finds the links and anchors in the HTML page at filename.
+func parsePage(filename string) (*linkedPage, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	p := &linkedPage{ids: map[string]bool{}}
+	z := html.NewTokenizer(bytes.NewReader(b))
+	line := 1
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return p, nil
+			}
+			return nil, z.Err()
+		}
+		tokenLine := line
+		line += bytes.Count(z.Raw(), []byte("\n"))
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		t := z.Token()
+		for _, a := range t.Attr {
+			switch {
+			case a.Key == "id", a.Key == "name" && t.Data == "a":
+				p.ids[a.Val] = true
+			case a.Key == "href", a.Key == "src":
+				p.links = append(p.links, Link{Page: filename, Line: tokenLine, URL: a.Val})
+			}
+		}
+	}
+}
+
+// CheckLinks checks every href and src in the HTML pages of the output
+// directory of a built docset, reporting links to pages or anchors that don't
+// exist.
+func CheckLinks(d *DocSet) (*LinkReport, error) {
+	dst := filepath.Join(d.Root, d.Config.Output)
+	manifest, err := LoadManifest(filepath.Join(d.Root, ManifestFilename))
+	if err != nil {
+		return nil, err
+	}
+	var domain *url.URL
+	if d.Config.Domain != "" {
+		if domain, err = url.Parse(d.Config.Domain); err != nil {
+			return nil, err
+		}
+	}
+
+	pages := map[string]*linkedPage{}
+	names := []string{}
+	err = filepath.Walk(dst, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(name) != ".html" {
+			return nil
+		}
+		p, err := parsePage(name)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		rel, err := filepath.Rel(d.Root, name)
+		if err != nil {
+			return err
+		}
+		source := manifest.Outputs[rel].Source
+		for i := range p.links {
+			p.links[i].Source = source
+		}
+		if source != "" {
+			if src, err := os.ReadFile(filepath.Join(d.Root, source)); err == nil {
+				sourceLines(p.links, src)
+			}
+		}
+		pages[name] = p
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	report := &LinkReport{}
+	for _, name := range names {
+		rel, err := filepath.Rel(dst, name)
+		if err != nil {
+			return nil, err
+		}
+		base := &url.URL{Path: "/" + filepath.ToSlash(rel)}
+		for _, link := range pages[name].links {
+			u, err := url.Parse(strings.TrimSpace(link.URL))
+			if err != nil {
+				report.Problems = append(report.Problems, LinkProblem{link, "Invalid URL."})
+				continue
+			}
+			if u.Scheme != "" || u.Host != "" {
+				if domain == nil || u.Host != domain.Host {
+					if u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "" {
+						report.External = append(report.External, link)
+					}
+					continue
+				}
+				u = &url.URL{Path: u.Path, Fragment: u.Fragment}
+			}
+			target := name
+			if u.Path != "" {
+				target = ResolveURL(dst, base.ResolveReference(u).Path)
+				if target == "" {
+					report.Problems = append(report.Problems, LinkProblem{link, "Missing target."})
+					continue
+				}
+			}
+			if u.Fragment == "" {
+				continue
+			}
+			if p, ok := pages[target]; ok && !p.ids[u.Fragment] {
+				report.Problems = append(report.Problems, LinkProblem{link, fmt.Sprintf("Missing anchor #%s.", u.Fragment)})
+			}
+		}
+	}
+	return report, nil
+}
+
+// CheckExternalLinks checks that each of the links, which should be those in
+// LinkReport.External, can be fetched. Each URL is only fetched once, no
+// matter how many times it appears.
+func CheckExternalLinks(ctx context.Context, client *http.Client, links []Link) []LinkProblem {
+	byURL := map[string][]Link{}
+	urls := []string{}
+	for _, link := range links {
+		u := strings.TrimSpace(link.URL)
+		if strings.HasPrefix(u, "//") {
+			u = "https:" + u
+		}
+		if _, ok := byURL[u]; !ok {
+			urls = append(urls, u)
+		}
+		byURL[u] = append(byURL[u], link)
+	}
+
+	results := make([]string, len(urls))
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, 8)
+	for i, u := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+			results[i] = fetchProblem(ctx, client, u)
+		}(i, u)
+	}
+	wg.Wait()
+
+	problems := []LinkProblem{}
+	for i, u := range urls {
+		if results[i] == "" {
+			continue
+		}
+		for _, link := range byURL[u] {
+			problems = append(problems, LinkProblem{link, results[i]})
+		}
+	}
+	return problems
+}
+
+// fetchProblem fetches the URL and returns what is wrong with it, or "" if
+// nothing is. Servers that don't support HEAD are tried again with GET.
+func fetchProblem(ctx context.Context, client *http.Client, u string) string {
+	status := 0
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, u, nil)
+		if err != nil {
+			return fmt.Sprintf("Invalid URL: %s", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Sprintf("Failed to fetch: %s", err)
+		}
+		resp.Body.Close()
+		status = resp.StatusCode
+		if status != http.StatusMethodNotAllowed && status != http.StatusNotImplemented {
+			break
+		}
+	}
+	if status >= 400 {
+		return fmt.Sprintf("Got status %d.", status)
+	}
+	return ""
+}
@@ -0,0 +1,129 @@
+package piccolo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckLinks(t *testing.T) {
+	d := testSite(t)
+	src := `<html><head><title>Links</title><meta name="created" value="2010-01-01T00:00:00"></head><body>
+<p id="here"><a href="#here">ok</a></p>
+<a href="/a/test">ok</a> <a href="test-no-meta">ok</a> <a href="/archives/">ok</a>
+<a href="https://example.org/a/markdown">ok</a>
+<a href="/a/missing">missing</a>
+<a href="/a/test#nope">no anchor</a>
+<img src="pic.png">
+<a href="https://other.org/">external</a> <a href="mailto:joe@example.org">mail</a>
+</body></html>`
+	if err := os.WriteFile(filepath.Join(d.Root, "a", "links.html"), []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to write: %v\n", err)
+	}
+	if _, err := NewBuilder(d, d.Config).Build(context.Background()); err != nil {
+		t.Fatalf("Failed to build: %v\n", err)
+	}
+	report, err := CheckLinks(d)
+	if err != nil {
+		t.Fatalf("Failed to check links: %v\n", err)
+	}
+	// The includes of the test site have broken links of their own, so only
+	// look at the links in the body of the entry.
+	page := filepath.Join(d.Root, d.Config.Output, "a", "links.html")
+	got := map[string]LinkProblem{}
+	for _, p := range report.Problems {
+		if p.Page == page {
+			got[p.URL] = p
+		}
+	}
+	testCases := []struct {
+		url     string
+		problem string
+	}{
+		{"/a/missing", "Missing target."},
+		{"/a/test#nope", "Missing anchor #nope."},
+		{"pic.png", "Missing target."},
+	}
+	for _, tc := range testCases {
+		p, ok := got[tc.url]
+		if !ok {
+			t.Errorf("Missing problem for %s\n", tc.url)
+			continue
+		}
+		if p.Problem != tc.problem || p.Source != "a/links.html" {
+			t.Errorf("Wrong problem for %s: Got %q from %q, Want %q\n", tc.url, p.Problem, p.Source, tc.problem)
+		}
+	}
+	// Lines are counted from the top of the generated page, and of the
+	// source.
+	if got[testCases[1].url].Line != got[testCases[0].url].Line+1 {
+		t.Errorf("Wrong lines: Got %d and %d\n", got[testCases[0].url].Line, got[testCases[1].url].Line)
+	}
+	for i, want := range []int{5, 6, 7} {
+		if p := got[testCases[i].url]; p.SourceLine != want {
+			t.Errorf("Wrong source line for %s: Got %d, Want %d\n", p.URL, p.SourceLine, want)
+		}
+	}
+	if got, want := got["/a/missing"].String(), "a/links.html:5: /a/missing: Missing target."; got != want {
+		t.Errorf("Got %v, Want %v\n", got, want)
+	}
+	for _, ok := range []string{"#here", "/a/test", "test-no-meta", "/archives/", "https://example.org/a/markdown", "https://other.org/"} {
+		if p, found := got[ok]; found {
+			t.Errorf("Unexpected problem: %s\n", p)
+		}
+	}
+	external := []string{}
+	for _, l := range report.External {
+		if l.Page == page {
+			external = append(external, l.URL)
+		}
+	}
+	if !strings.Contains(strings.Join(external, " "), "https://other.org/") || strings.Contains(strings.Join(external, " "), "mailto") {
+		t.Errorf("Wrong external links: Got %v\n", external)
+	}
+}
+
+func TestCheckExternalLinks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+		case "/nohead":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	links := []Link{
+		{Page: "a.html", Line: 1, URL: ts.URL + "/ok"},
+		{Page: "a.html", Line: 2, URL: ts.URL + "/nohead"},
+		{Page: "a.html", Line: 3, URL: ts.URL + "/gone"},
+		{Page: "b.html", Line: 4, URL: ts.URL + "/gone"},
+	}
+	problems := CheckExternalLinks(context.Background(), ts.Client(), links)
+	if got, want := len(problems), 2; got != want {
+		t.Fatalf("Wrong number of problems: Got %d, Want %d: %v\n", got, want, problems)
+	}
+	for _, p := range problems {
+		if !strings.HasSuffix(p.URL, "/gone") || p.Problem != "Got status 404." {
+			t.Errorf("Wrong problem: Got %v\n", p)
+		}
+	}
+}
+
+func TestSourceLines(t *testing.T) {
+	src := []byte("[a](/a) and [b](/a/b)\n<a href=\"/a\">again</a> /a?x=1&amp;y=2\n\n<img src='/a?x=1&amp;y=2'>")
+	links := []Link{{URL: "/a"}, {URL: "/a/b"}, {URL: "/a"}, {URL: "/a?x=1&y=2"}, {URL: "/a"}, {URL: "/nope"}}
+	sourceLines(links, src)
+	for i, want := range []int{1, 1, 2, 2, 1, 0} {
+		if got := links[i].SourceLine; got != want {
+			t.Errorf("%s: Got %v, Want %v\n", links[i].URL, got, want)
+		}
+	}
+}
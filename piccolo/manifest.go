@@ -0,0 +1,106 @@
+package piccolo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ManifestFilename is the location of the build manifest, relative to the
+// root.
+const ManifestFilename = "tmp/piccolo-manifest.json"
+
+// ManifestEntry records how a single output file was produced.
+type ManifestEntry struct {
+	// Source is the path of the source file, relative to the root.
+	Source string `json:"source"`
+
+	// Hash is the hash of all the inputs used to produce the output.
+	Hash string `json:"hash"`
+
+	// Files are the paths, relative to the root, of the other files written
+	// along with the output by transforms, e.g. rendered LaTex.
+	Files []string `json:"files,omitempty"`
+}
+
+// Manifest records the inputs of every file written by a build, so the next
+// build can tell which outputs are out of date without relying on
+// modification times.
+type Manifest struct {
+	// Outputs is indexed by the path of the output file, relative to the root.
+	Outputs map[string]ManifestEntry `json:"outputs"`
+}
+
+// NewManifest returns an empty Manifest.
+func NewManifest() *Manifest {
+	return &Manifest{Outputs: map[string]ManifestEntry{}}
+}
+
+// LoadManifest loads a Manifest from path. A missing file results in an
+// empty Manifest.
+func LoadManifest(path string) (*Manifest, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewManifest(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := NewManifest()
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("Failed to parse manifest %s: %s", path, err)
+	}
+	if m.Outputs == nil {
+		m.Outputs = map[string]ManifestEntry{}
+	}
+	return m, nil
+}
+
+// Save writes the Manifest to path.
+func (m *Manifest) Save(path string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// hashFiles returns the combined hash of the contents of the files, in order.
+// Missing files hash differently from empty files.
+func hashFiles(paths ...string) (string, error) {
+	h := sha256.New()
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			fmt.Fprintf(h, "missing:%s\n", filepath.Base(path))
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "file:%s\n", filepath.Base(path))
+		n, err := io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "\n%d\n", n)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashStrings returns the combined hash of the strings.
+func hashStrings(s ...string) string {
+	h := sha256.New()
+	for _, v := range s {
+		fmt.Fprintf(h, "%d:%s", len(v), v)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
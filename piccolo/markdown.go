@@ -0,0 +1,311 @@
+package piccolo
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	mdhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+)
+
+// Front matter delimiters.
+const (
+	yamlDelim = "---"
+	tomlDelim = "+++"
+)
+
+// markdown converts Markdown into HTML. Raw HTML is passed through so that
+// elements such as <latex-pic> work in Markdown entries.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(mdhtml.WithUnsafe()),
+)
+
+// dollarMarkdown converts Markdown into HTML like markdown, but leaves LaTex
+// between dollar signs, and escaped dollar signs, as they are for DollarMath.
+var dollarMarkdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithInlineParsers(util.Prioritized(dollarParser{}, 100))),
+	goldmark.WithRendererOptions(mdhtml.WithUnsafe()),
+)
+
+// dollarParser is an inline parser that finds LaTex between dollar signs the
+// same way DollarMath does, so that emphasis and backslash escapes in the
+// LaTex, e.g. $a*b*c$, aren't turned into HTML. Escaped dollar signs keep
+// their backslash, so DollarMath knows they aren't math.
+type dollarParser struct{}
+
+// Trigger implements parser.InlineParser.
+func (dollarParser) Trigger() []byte {
+	return []byte{'$', '\\'}
+}
+
+// Parse implements parser.InlineParser.
+func (dollarParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	s := string(line)
+	switch {
+	case strings.HasPrefix(s, `\$`):
+		return verbatim(block, `\$`)
+	case strings.HasPrefix(s, "$$"):
+		// Display math may go over several lines.
+		l, pos := block.Position()
+		src := ""
+		for line != nil {
+			src += string(line)
+			if end := closingDollars(src, 2); end != -1 {
+				block.Advance(end + 2 - (len(src) - len(line)))
+				return verbatimString(src[:end+2])
+			}
+			block.AdvanceLine()
+			line, _ = block.PeekLine()
+		}
+		block.SetPosition(l, pos)
+		return verbatim(block, "$$")
+	case strings.HasPrefix(s, "$"):
+		if end := closingDollar(s, 1); end != -1 {
+			return verbatim(block, s[:end+1])
+		}
+	}
+	return nil
+}
+
+// verbatim advances the block past s, which it starts with, and returns the
+// node for s.
+func verbatim(block text.Reader, s string) ast.Node {
+	block.Advance(len(s))
+	return verbatimString(s)
+}
+
+// verbatimString returns a node that is rendered as s, only escaped for HTML.
+func verbatimString(s string) ast.Node {
+	n := ast.NewString([]byte(s))
+	n.SetRaw(true)
+	return n
+}
+
+// page is the HTML document a Markdown entry is converted into.
+const page = `<!DOCTYPE html>
+<html>
+  <head>
+    <title>%s</title>
+  </head>
+  <body>
+%s
+  </body>
+</html>
+`
+
+// splitFrontMatter splits Markdown source into the front matter and the body.
+// The front matter must start on the first line and is delimited by "---"
+// lines for YAML or "+++" lines for TOML. The delimiter is returned, or "" if
+// there is no front matter.
+func splitFrontMatter(src []byte) (string, []byte, []byte, error) {
+	for _, delim := range []string{yamlDelim, tomlDelim} {
+		open := []byte(delim + "\n")
+		if !bytes.HasPrefix(src, open) {
+			continue
+		}
+		rest := src[len(open):]
+		close := []byte("\n" + delim + "\n")
+		if bytes.HasPrefix(rest, close[1:]) {
+			return delim, nil, rest[len(close)-1:], nil
+		}
+		i := bytes.Index(rest, close)
+		if i == -1 {
+			if bytes.HasSuffix(rest, close[:len(close)-1]) {
+				return delim, rest[:len(rest)-len(close)+1], nil, nil
+			}
+			return "", nil, nil, fmt.Errorf("Unterminated front matter, missing closing %q.", delim)
+		}
+		return delim, rest[:i], rest[i+len(close):], nil
+	}
+	return "", nil, src, nil
+}
+
+// parseFrontMatter decodes the front matter into a map.
+func parseFrontMatter(delim string, front []byte) (map[string]interface{}, error) {
+	meta := map[string]interface{}{}
+	var err error
+	switch delim {
+	case yamlDelim:
+		err = yaml.Unmarshal(front, &meta)
+	case tomlDelim:
+		err = toml.Unmarshal(front, &meta)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse front matter: %s", err)
+	}
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	return meta, nil
+}
+
+// parseTime parses a time in one of the formats accepted for the created
+// meta element, or just a date.
+func parseTime(value string) (time.Time, error) {
+	for _, f := range []string{format, format_no_tz, "2006-01-02"} {
+		if t, err := time.Parse(f, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid time: %q", value)
+}
+
+// metaTime converts a front matter value into a time. Both YAML and TOML may
+// have already decoded it into a time.Time.
+func metaTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		return parseTime(v)
+	}
+	return time.Time{}, fmt.Errorf("Invalid time: %v", value)
+}
+
+// addCreated returns the Markdown source with the created time added to the
+// front matter, creating YAML front matter if there wasn't any. The added
+// lines end the same way as the first line of src, with "\n" or "\r\n".
+func addCreated(src []byte, delim string, created time.Time) []byte {
+	value := created.Format(format)
+	nl := "\n"
+	if i := bytes.IndexByte(src, '\n'); i > 0 && src[i-1] == '\r' {
+		nl = "\r\n"
+	}
+	switch delim {
+	case yamlDelim:
+		return append([]byte(yamlDelim+nl+"created: "+value+nl), src[len(yamlDelim)+len(nl):]...)
+	case tomlDelim:
+		return append([]byte(fmt.Sprintf("%s%screated = %q%s", tomlDelim, nl, value, nl)), src[len(tomlDelim)+len(nl):]...)
+	}
+	return append([]byte(yamlDelim+nl+"created: "+value+nl+yamlDelim+nl), src...)
+}
+
+// markdownInfo parses a Markdown entry and converts it into HTML. If dollars is
+// true, LaTex between dollar signs is left for DollarMath.
+//
+// It returns a FileInfo for the entry and, if the front matter had no created
+// time, the source with the created time added. The returned source is nil if
+// nothing was added.
+func markdownInfo(path string, dollars bool) (*FileInfo, []byte, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Only a copy is normalized, so the created time can be added without
+	// changing the line endings of the file.
+	delim, front, body, err := splitFrontMatter(bytes.ReplaceAll(src, []byte("\r\n"), []byte("\n")))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", path, err)
+	}
+	meta, err := parseFrontMatter(delim, front)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	var updated []byte
+	var created time.Time
+	if value, ok := meta["created"]; ok {
+		created, err = metaTime(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: Invalid \"created\": %s", path, err)
+		}
+	} else {
+		created = time.Now()
+		updated = addCreated(src, delim, created)
+	}
+	title := ""
+	if value, ok := meta["title"]; ok {
+		title = fmt.Sprint(value)
+	}
+
+	md := markdown
+	if dollars {
+		md = dollarMarkdown
+	}
+	var rendered bytes.Buffer
+	if err := md.Convert(body, &rendered); err != nil {
+		return nil, nil, fmt.Errorf("%s: Failed to render Markdown: %s", path, err)
+	}
+	doc, err := html.Parse(strings.NewReader(fmt.Sprintf(page, html.EscapeString(title), rendered.String())))
+	if err != nil {
+		return nil, nil, err
+	}
+	fi := &FileInfo{
+		Path:    path,
+		Node:    doc,
+		Title:   title,
+		Created: created,
+		Updated: stat.ModTime(),
+	}
+	metas := map[string]string{}
+	for k, v := range meta {
+		metas[k] = metaString(v)
+	}
+	if err := fi.applyMeta(metas); err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return fi, updated, nil
+}
+
+// IsEntry returns true if the file at path, with the given attributes, is an
+// entry, i.e. an HTML or Markdown file in an .include directory.
+func IsEntry(path string, attr Attr) bool {
+	if !attr.Has(INCLUDE) {
+		return false
+	}
+	ext := filepath.Ext(path)
+	return ext == ".html" || ext == ".md"
+}
+
+// EntryInfo returns the FileInfo for an HTML or Markdown entry. The bool
+// returned is true if the entry was missing its creation time.
+func EntryInfo(path string) (*FileInfo, bool, error) {
+	if filepath.Ext(path) == ".md" {
+		fi, updated, err := markdownInfo(path, false)
+		return fi, updated != nil, err
+	}
+	return CreationDate(path)
+}
+
+// EntryInfoSaved returns the FileInfo for an HTML or Markdown entry, writing
+// the creation time back into the file if it was missing.
+func EntryInfoSaved(path string) (*FileInfo, error) {
+	return entryInfoSaved(path, false)
+}
+
+// entryInfoSaved is EntryInfoSaved, with LaTex between dollar signs in
+// Markdown left for DollarMath if dollars is true.
+func entryInfoSaved(path string, dollars bool) (*FileInfo, error) {
+	if filepath.Ext(path) != ".md" {
+		return CreationDateSaved(path)
+	}
+	fi, updated, err := markdownInfo(path, dollars)
+	if err != nil {
+		return nil, err
+	}
+	if updated != nil {
+		if err := os.WriteFile(path, updated, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return fi, nil
+}
@@ -0,0 +1,157 @@
+package piccolo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	testCases := []struct {
+		Src   string
+		Delim string
+		Front string
+		Body  string
+		Err   bool
+	}{
+		{"No front matter.\n", "", "", "No front matter.\n", false},
+		{"---\ntitle: T\n---\nBody\n", "---", "title: T", "Body\n", false},
+		{"+++\ntitle = \"T\"\n+++\nBody\n", "+++", "title = \"T\"", "Body\n", false},
+		{"---\n---\nBody\n", "---", "", "Body\n", false},
+		{"---\ntitle: T\n---", "---", "title: T", "", false},
+		{"---\ntitle: T\nBody\n", "", "", "", true},
+	}
+	for _, tc := range testCases {
+		delim, front, body, err := splitFrontMatter([]byte(tc.Src))
+		if tc.Err {
+			if err == nil {
+				t.Errorf("Expected an error for %q\n", tc.Src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v\n", tc.Src, err)
+		}
+		if delim != tc.Delim || string(front) != tc.Front || string(body) != tc.Body {
+			t.Errorf("Wrong split of %q: Got %q %q %q, Want %q %q %q\n", tc.Src, delim, front, body, tc.Delim, tc.Front, tc.Body)
+		}
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get cwd: %v\n", err)
+	}
+	testCases := []struct {
+		Filename string
+		IsNew    bool
+		Title    string
+		Tags     string
+		Body     string
+	}{
+		{"test1/a/markdown.md", false, "A Markdown Entry", "go,markdown", "<em>Markdown</em>"},
+		{"markdown-toml.md", false, "TOML front matter", "toml", "<strong>text</strong>"},
+		{"markdown-nodate.md", true, "No date supplied", "a,b", "<p>Some text.</p>"},
+	}
+	for _, tc := range testCases {
+		path := filepath.Join(cwd, "tests", "src", tc.Filename)
+		fi, isNew, err := EntryInfo(path)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v\n", tc.Filename, err)
+		}
+		if got, want := fi.Title, tc.Title; got != want {
+			t.Errorf("Title wrong for %s, Got %v, Want %v\n", tc.Filename, got, want)
+		}
+		if got, want := strings.Join(fi.Tags, ","), tc.Tags; got != want {
+			t.Errorf("Tags wrong for %s, Got %v, Want %v\n", tc.Filename, got, want)
+		}
+		if isNew != tc.IsNew {
+			t.Errorf("Metadata expectations wrong for %s, Want %v, Got %v\n", tc.Filename, tc.IsNew, isNew)
+		}
+		if got := StrFromNodes(fi.Body()); !strings.Contains(got, tc.Body) {
+			t.Errorf("Body wrong for %s, Got %v, Want %v\n", tc.Filename, got, tc.Body)
+		}
+		expected := time.Date(2009, time.January, 1, 0, 0, 0, 0, time.UTC)
+		if fi.Created.Before(expected) {
+			t.Errorf("Unexpected date: %v in %s\n", fi.Created, tc.Filename)
+		}
+	}
+}
+
+func TestMarkdownSaved(t *testing.T) {
+	testCases := []string{
+		"---\ntitle: YAML\n---\nBody\n",
+		"+++\ntitle = \"TOML\"\n+++\nBody\n",
+		"Body\n",
+		"---\r\ntitle: CRLF\r\n---\r\nBody\r\n",
+		"+++\r\ntitle = \"CRLF\"\r\n+++\r\nBody\r\n",
+		"Body\r\n",
+	}
+	for _, src := range testCases {
+		path := filepath.Join(t.TempDir(), "entry.md")
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatalf("Failed to write: %v\n", err)
+		}
+		fi, err := EntryInfoSaved(path)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v\n", src, err)
+		}
+		again, isNew, err := EntryInfo(path)
+		if err != nil {
+			t.Fatalf("Failed to parse saved %q: %v\n", src, err)
+		}
+		if isNew {
+			t.Errorf("Created time wasn't saved for %q\n", src)
+		}
+		if !again.Created.Equal(fi.Created.Truncate(time.Second)) {
+			t.Errorf("Saved created time differs for %q: Got %v, Want %v\n", src, again.Created, fi.Created)
+		}
+		if got := StrFromNodes(again.Body()); !strings.Contains(got, "<p>Body</p>") {
+			t.Errorf("Saving changed the body of %q: %s\n", src, got)
+		}
+		// The rest of the file, and its line endings, are left alone.
+		saved, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read: %v\n", err)
+		}
+		if strings.Contains(src, "\r\n") && strings.Count(string(saved), "\n") != strings.Count(string(saved), "\r\n") {
+			t.Errorf("Line endings changed for %q: %q\n", src, saved)
+		}
+		if !strings.HasSuffix(string(saved), src[strings.Index(src, "\n")+1:]) {
+			t.Errorf("Saving changed %q: %q\n", src, saved)
+		}
+	}
+}
+
+func TestMarkdownDollars(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want string
+	}{
+		{`So $x^2$.`, `<p>So <latex-inline>x^2</latex-inline>.</p>`},
+		{`So $a*b*c$ and *d*.`, `<p>So <latex-inline>a*b*c</latex-inline> and <em>d</em>.</p>`},
+		{`Costs \$5, \$x\$ or $\$x$.`, `<p>Costs $5, $x$ or <latex-inline>\$x</latex-inline>.</p>`},
+		{`From $5 to $10, *really*.`, `<p>From $5 to $10, <em>really</em>.</p>`},
+		{`Accented $à$ and $ é$.`, `<p>Accented <latex-inline>à</latex-inline> and $ é$.</p>`},
+		{"$$\na_1 \\\\\nb*c*\n$$", "<p><latex-pic>\na_1 \\\\\nb*c*\n</latex-pic></p>"},
+		{"Unclosed $$a$ and `$b$`.", "<p>Unclosed $$a$ and <code>$b$</code>.</p>"},
+		{`A \*star\*.`, `<p>A *star*.</p>`},
+	}
+	for _, tc := range testCases {
+		path := filepath.Join(t.TempDir(), "math.md")
+		if err := os.WriteFile(path, []byte("---\ntitle: Math\ncreated: 2010-01-01\n---\n"+tc.in+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write: %v\n", err)
+		}
+		fi, _, err := markdownInfo(path, true)
+		if err != nil {
+			t.Fatalf("Failed to convert %q: %v\n", tc.in, err)
+		}
+		DollarMath(fi.Node)
+		if got := strings.TrimSpace(StrFromNodes(fi.Body())); got != tc.want {
+			t.Errorf("Got %v, Want %v\n", got, tc.want)
+		}
+	}
+}
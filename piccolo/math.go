@@ -0,0 +1,328 @@
+package piccolo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.skia.org/infra/go/exec"
+	"golang.org/x/net/html"
+)
+
+// MathRenderer renders LaTex math for the latex transform.
+type MathRenderer interface {
+	// Ext is the extension of what Render produces, ".png" or ".svg" for
+	// images, or MathMLExt for MathML markup.
+	Ext() string
+
+	// Options describes the options the renderer runs with, e.g. the
+	// arguments of the commands it runs. Rendered LaTex is cached by them, so
+	// they must change whenever the output would.
+	Options() string
+
+	// Render renders the LaTex src, as a display or, if inline is true, as
+	// math within a line of text. The file tex2im_header in root holds any
+	// extra LaTex preamble, such as \usepackage lines.
+	//
+	// Inline images should be aligned with the baseline of the text, which
+	// for SVGs is done by giving the vertical-align in the style of the root
+	// element, as MathJax does.
+	Render(root, src string, inline bool) ([]byte, error)
+}
+
+// MathMLExt is the extension of MathML produced by a MathRenderer.
+const MathMLExt = ".mathml"
+
+// defaultMathRenderer is used if the config doesn't name a renderer.
+const defaultMathRenderer = "tex2im"
+
+var (
+	mathRenderersMutex sync.Mutex
+	mathRenderers      = map[string]MathRenderer{}
+)
+
+func init() {
+	RegisterMathRenderer("tex2im", tex2imRenderer{})
+	RegisterMathRenderer("dvisvgm", dvisvgmRenderer{})
+	RegisterMathRenderer("mathml", mathMLRenderer{})
+}
+
+// RegisterMathRenderer makes a MathRenderer available under the given name for
+// use in the "latex.renderer" config. It is meant to be called from init
+// functions, and panics if the name is already registered.
+func RegisterMathRenderer(name string, r MathRenderer) {
+	mathRenderersMutex.Lock()
+	defer mathRenderersMutex.Unlock()
+	if _, ok := mathRenderers[name]; ok {
+		panic(fmt.Sprintf("Math renderer %q registered twice.", name))
+	}
+	mathRenderers[name] = r
+}
+
+// LookupMathRenderer returns the registered MathRenderer with the given name,
+// or the tex2im renderer if the name is empty.
+func LookupMathRenderer(name string) (MathRenderer, error) {
+	if name == "" {
+		name = defaultMathRenderer
+	}
+	mathRenderersMutex.Lock()
+	defer mathRenderersMutex.Unlock()
+	r, ok := mathRenderers[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown math renderer %q.", name)
+	}
+	return r, nil
+}
+
+// runCommand runs the named command in the directory dir, returning an error
+// that includes its output if it fails.
+func runCommand(dir, name string, args ...string) error {
+	output := bytes.Buffer{}
+	err := exec.Run(&exec.Command{
+		Name:           name,
+		Args:           args,
+		Env:            []string{},
+		Dir:            dir,
+		CombinedOutput: &output,
+		Timeout:        10 * time.Minute,
+		InheritPath:    true,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to run %s: %q %s", name, output, err)
+	}
+	return nil
+}
+
+// latexMath returns the LaTex that typesets src inline, or as a display the
+// same way tex2im does.
+func latexMath(src string, inline bool) string {
+	if inline {
+		return "$" + src + "$"
+	}
+	return "\\begin{eqnarray*}\n" + src + "\n\\end{eqnarray*}"
+}
+
+// latexDocument returns a LaTex document with the given body, and the
+// preamble from the tex2im_header file in root.
+func latexDocument(root, body string) (string, error) {
+	header, err := ioutil.ReadFile(filepath.Join(root, "tex2im_header"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return fmt.Sprintf("\\documentclass{article}\n%s\n\\pagestyle{empty}\n\\begin{document}\n%s\n\\end{document}\n", header, body), nil
+}
+
+// tex2imArgs are the options tex2im is run with, other than the files.
+const tex2imArgs = "-z -a -r 100x100"
+
+// tex2imRenderer renders PNGs with tex2im.
+type tex2imRenderer struct{}
+
+// Ext implements MathRenderer.
+func (tex2imRenderer) Ext() string {
+	return ".png"
+}
+
+// Options implements MathRenderer.
+func (tex2imRenderer) Options() string {
+	return tex2imArgs
+}
+
+// Render implements MathRenderer. There's no way to find the baseline of the
+// PNGs.
+func (tex2imRenderer) Render(root, src string, inline bool) ([]byte, error) {
+	// Create a tmp file to write the Latex code into.
+	file, err := ioutil.TempFile("/tmp", "piccolo-latex-")
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't create temp file: %s", err)
+	}
+	// tex2im puts the LaTex in an eqnarray* environment, unless told not to
+	// with -n.
+	opts := tex2imArgs
+	if inline {
+		src = latexMath(src, inline)
+		opts += " -n"
+	}
+	_, err = file.Write([]byte(src))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to write file: %s", err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+	// And create a tmp file to receive the PNG.
+	dest, err := ioutil.TempFile("/tmp", "piccolo-latex-")
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't create temp file: %s", err)
+	}
+	dest.Close()
+	defer os.Remove(dest.Name())
+	// Convert the latex to a PNG with:
+	//
+	//   tex2im  -z -a -o ./dst/test.png test.tex
+	args := fmt.Sprintf("%s -x %s/tex2im_header -o %s %s", opts, root, dest.Name(), file.Name())
+	if err := runCommand("", "tex2im", strings.Split(args, " ")...); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(dest.Name())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read PNG: %s", err)
+	}
+	return b, nil
+}
+
+// dvisvgmRenderer renders SVGs with latex and dvisvgm. The glyphs are turned
+// into paths, so the SVGs don't depend on any fonts.
+type dvisvgmRenderer struct{}
+
+// Ext implements MathRenderer.
+func (dvisvgmRenderer) Ext() string {
+	return ".svg"
+}
+
+// latexArgs and dvisvgmArgs are the options latex and dvisvgm are run with,
+// other than the files.
+var (
+	latexArgs   = []string{"-interaction=nonstopmode", "-halt-on-error"}
+	dvisvgmArgs = []string{"--no-fonts", "--exact-bbox"}
+)
+
+// Options implements MathRenderer.
+func (dvisvgmRenderer) Options() string {
+	return strings.Join(latexArgs, " ") + " " + strings.Join(dvisvgmArgs, " ")
+}
+
+// depthMessage is written to the LaTex log, followed by the depth below the
+// baseline of inline math, e.g. "1.94444pt".
+const depthMessage = "piccolo-depth="
+
+// depthRegexp finds the depth written after depthMessage in the LaTex log.
+var depthRegexp = regexp.MustCompile(depthMessage + `(-?[0-9.]+pt)`)
+
+// Render implements MathRenderer.
+func (dvisvgmRenderer) Render(root, src string, inline bool) ([]byte, error) {
+	body := latexMath(src, inline)
+	if inline {
+		// Measure how far the math goes below the baseline.
+		body = fmt.Sprintf("\\newsavebox{\\piccolobox}\\savebox{\\piccolobox}{%s}\\typeout{%s\\the\\dp\\piccolobox}\\usebox{\\piccolobox}", body, depthMessage)
+	}
+	doc, err := latexDocument(root, body)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir("", "piccolo-latex-")
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "math.tex"), []byte(doc), 0644); err != nil {
+		return nil, fmt.Errorf("Failed to write file: %s", err)
+	}
+	if err := runCommand(dir, "latex", append(append([]string{}, latexArgs...), "math.tex")...); err != nil {
+		return nil, err
+	}
+	if err := runCommand(dir, "dvisvgm", append(append([]string{}, dvisvgmArgs...), "--output=math.svg", "math.dvi")...); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "math.svg"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read SVG: %s", err)
+	}
+	if !inline {
+		return b, nil
+	}
+	log, err := ioutil.ReadFile(filepath.Join(dir, "math.log"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read LaTex log: %s", err)
+	}
+	m := depthRegexp.FindSubmatch(log)
+	if m == nil {
+		return nil, fmt.Errorf("No depth found in the LaTex log.")
+	}
+	return svgBaseline(b, string(m[1])), nil
+}
+
+// svgBaseline adds the vertical-align that puts the baseline of the SVG b,
+// which goes depth below its baseline, on the baseline of the text, to the
+// style of the root element.
+func svgBaseline(b []byte, depth string) []byte {
+	align := "-" + depth
+	if strings.HasPrefix(depth, "-") {
+		align = depth[1:]
+	}
+	return bytes.Replace(b, []byte("<svg "), []byte(fmt.Sprintf("<svg style=\"vertical-align: %s\" ", align)), 1)
+}
+
+// mathMLRenderer renders MathML with pandoc.
+type mathMLRenderer struct{}
+
+// Ext implements MathRenderer.
+func (mathMLRenderer) Ext() string {
+	return MathMLExt
+}
+
+// pandocArgs are the options pandoc is run with, other than the files.
+var pandocArgs = []string{"--from=latex", "--to=html", "--mathml"}
+
+// Options implements MathRenderer.
+func (mathMLRenderer) Options() string {
+	return strings.Join(pandocArgs, " ")
+}
+
+// Render implements MathRenderer.
+func (mathMLRenderer) Render(root, src string, inline bool) ([]byte, error) {
+	doc, err := latexDocument(root, latexMath(src, inline))
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir("", "piccolo-latex-")
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "math.tex"), []byte(doc), 0644); err != nil {
+		return nil, fmt.Errorf("Failed to write file: %s", err)
+	}
+	if err := runCommand(dir, "pandoc", append(append([]string{}, pandocArgs...), "--output=math.html", "math.tex")...); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "math.html"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read MathML: %s", err)
+	}
+	return mathElement(b)
+}
+
+// mathElement returns the first <math> element in the HTML b.
+func mathElement(b []byte) ([]byte, error) {
+	doc, err := html.Parse(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	var find func(*html.Node) *html.Node
+	find = func(n *html.Node) *html.Node {
+		if n.Type == html.ElementNode && n.Data == "math" {
+			return n
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if m := find(c); m != nil {
+				return m
+			}
+		}
+		return nil
+	}
+	m := find(doc)
+	if m == nil {
+		return nil, fmt.Errorf("No MathML found.")
+	}
+	buf := &bytes.Buffer{}
+	if err := html.Render(buf, m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
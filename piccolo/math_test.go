@@ -0,0 +1,95 @@
+package piccolo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLookupMathRenderer(t *testing.T) {
+	testCases := []struct {
+		Name string
+		Ext  string
+	}{
+		{"", ".png"},
+		{"tex2im", ".png"},
+		{"dvisvgm", ".svg"},
+		{"mathml", MathMLExt},
+		{"fake", ".png"},
+	}
+	for _, tc := range testCases {
+		r, err := LookupMathRenderer(tc.Name)
+		if err != nil {
+			t.Errorf("Failed to look up %q: %v\n", tc.Name, err)
+			continue
+		}
+		if got := r.Ext(); got != tc.Ext {
+			t.Errorf("Got %v, Want %v\n", got, tc.Ext)
+		}
+	}
+	if _, err := LookupMathRenderer("nope"); err == nil || !strings.Contains(err.Error(), `"nope"`) {
+		t.Errorf("Wrong error: Got %v, Want an error naming \"nope\"\n", err)
+	}
+}
+
+func TestLatexDocument(t *testing.T) {
+	root := t.TempDir()
+	doc, err := latexDocument(root, latexMath("x^2", false))
+	if err != nil {
+		t.Fatalf("Failed to build document: %v\n", err)
+	}
+	if want := "\\begin{document}\n\\begin{eqnarray*}\nx^2\n\\end{eqnarray*}\n\\end{document}"; !strings.Contains(doc, want) {
+		t.Errorf("Document doesn't contain %q:\n%s\n", want, doc)
+	}
+	if got, want := latexMath("x^2", true), "$x^2$"; got != want {
+		t.Errorf("Got %v, Want %v\n", got, want)
+	}
+	if err := os.WriteFile(filepath.Join(root, "tex2im_header"), []byte(`\usepackage{amsmath}`), 0644); err != nil {
+		t.Fatalf("Failed to write header: %v\n", err)
+	}
+	doc, err = latexDocument(root, latexMath("x^2", false))
+	if err != nil {
+		t.Fatalf("Failed to build document: %v\n", err)
+	}
+	if want := "\\documentclass{article}\n\\usepackage{amsmath}\n"; !strings.HasPrefix(doc, want) {
+		t.Errorf("Document doesn't start with the header %q:\n%s\n", want, doc)
+	}
+}
+
+func TestMathElement(t *testing.T) {
+	b, err := mathElement([]byte(`<p><math display="block" xmlns="http://www.w3.org/1998/Math/MathML"><mi>x</mi></math></p>`))
+	if err != nil {
+		t.Fatalf("Failed to find MathML: %v\n", err)
+	}
+	if got, want := string(b), `<math display="block" xmlns="http://www.w3.org/1998/Math/MathML"><mi>x</mi></math>`; got != want {
+		t.Errorf("Got %v, Want %v\n", got, want)
+	}
+	if _, err := mathElement([]byte("<p>No math.</p>")); err == nil {
+		t.Errorf("Expected an error for HTML without MathML.\n")
+	}
+}
+
+func TestSVGBaseline(t *testing.T) {
+	svg := []byte(`<?xml version='1.0'?>` + "\n" + `<svg version='1.1' width='9pt'><g/></svg>`)
+	testCases := []struct {
+		depth string
+		want  string
+	}{
+		{"1.94444pt", `<svg style="vertical-align: -1.94444pt" version='1.1'`},
+		{"0.0pt", `<svg style="vertical-align: -0.0pt" version='1.1'`},
+		{"-1.0pt", `<svg style="vertical-align: 1.0pt" version='1.1'`},
+	}
+	for _, tc := range testCases {
+		got := string(svgBaseline(svg, tc.depth))
+		if !strings.Contains(got, tc.want) {
+			t.Errorf("Got %v, Want %v\n", got, tc.want)
+		}
+		if got, want := verticalAlign([]byte(got), ".svg"), tc.want[len(`<svg style="vertical-align: `):strings.Index(tc.want, `" `)]; got != want {
+			t.Errorf("Got %v, Want %v\n", got, want)
+		}
+	}
+	if m := depthRegexp.FindStringSubmatch("LaTeX Font Info: ...\npiccolo-depth=1.94444pt\n"); m == nil || m[1] != "1.94444pt" {
+		t.Errorf("Failed to find the depth: %v\n", m)
+	}
+}
@@ -0,0 +1,90 @@
+package piccolo
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// listKeys are the metadata names whose values are comma separated lists.
+// Repeated meta elements with these names are combined.
+var listKeys = map[string]bool{
+	"tags":       true,
+	"categories": true,
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(value string) []string {
+	ret := []string{}
+	for _, s := range strings.Split(value, ",") {
+		if s := strings.TrimSpace(s); s != "" {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// parseBool parses a flag such as draft. An empty value, i.e. the flag is
+// merely present, is true.
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "true", "yes", "1":
+		return true, nil
+	case "false", "no", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("Invalid boolean: %q", value)
+}
+
+// metaString converts a front matter value into the string it would have as
+// the value of a meta element.
+func metaString(value interface{}) string {
+	switch v := value.(type) {
+	case []interface{}:
+		s := make([]string, 0, len(v))
+		for _, item := range v {
+			s = append(s, metaString(item))
+		}
+		return strings.Join(s, ", ")
+	case time.Time:
+		return v.Format(format)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// applyMeta sets Meta, and the typed fields derived from it, from the
+// metadata values indexed by name.
+func (f *FileInfo) applyMeta(meta map[string]string) error {
+	f.Meta = meta
+	f.Tags = splitList(meta["tags"])
+	f.Categories = splitList(meta["categories"])
+	f.Summary = meta["summary"]
+	if f.Summary == "" {
+		f.Summary = meta["description"]
+	}
+	f.Author = meta["author"]
+	if value, ok := meta["draft"]; ok {
+		draft, err := parseBool(value)
+		if err != nil {
+			return fmt.Errorf("Invalid \"draft\": %s", err)
+		}
+		f.Draft = draft
+	}
+	if value, ok := meta["updated"]; ok {
+		updated, err := parseTime(value)
+		if err != nil {
+			return fmt.Errorf("Invalid \"updated\": %s", err)
+		}
+		f.Updated = updated
+	}
+	if slug, ok := meta["slug"]; ok {
+		if slug == "" || slug != path.Base(slug) || slug == "." || slug == ".." || strings.Contains(slug, "\\") {
+			return fmt.Errorf("Invalid \"slug\": %q must be a single path segment.", slug)
+		}
+		f.Slug = slug
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package piccolo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMeta(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get cwd: %v\n", err)
+	}
+	for _, filename := range []string{"meta.html", "meta.md"} {
+		fi, _, err := EntryInfo(filepath.Join(cwd, "tests", "src", filename))
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v\n", filename, err)
+		}
+		if got, want := strings.Join(fi.Tags, ","), "go,html,metadata"; got != want {
+			t.Errorf("Tags wrong for %s: Got %v, Want %v\n", filename, got, want)
+		}
+		if got, want := strings.Join(fi.Categories, ","), "programming"; got != want {
+			t.Errorf("Categories wrong for %s: Got %v, Want %v\n", filename, got, want)
+		}
+		if got, want := fi.Summary, "All the metadata."; got != want {
+			t.Errorf("Summary wrong for %s: Got %v, Want %v\n", filename, got, want)
+		}
+		if got, want := fi.Author, "Someone Else"; got != want {
+			t.Errorf("Author wrong for %s: Got %v, Want %v\n", filename, got, want)
+		}
+		if got, want := fi.Slug, "all-the-metadata"; got != want {
+			t.Errorf("Slug wrong for %s: Got %v, Want %v\n", filename, got, want)
+		}
+		if !fi.Draft {
+			t.Errorf("Draft wrong for %s\n", filename)
+		}
+		if got, want := fi.Updated, time.Date(2014, time.February, 3, 4, 5, 6, 0, time.UTC); !got.Equal(want) {
+			t.Errorf("Updated wrong for %s: Got %v, Want %v\n", filename, got, want)
+		}
+		if got, want := fi.Meta["custom"], "anything"; got != want {
+			t.Errorf("Custom metadata wrong for %s: Got %v, Want %v\n", filename, got, want)
+		}
+	}
+}
+
+func TestApplyMetaErrors(t *testing.T) {
+	testCases := []struct {
+		Meta map[string]string
+		Err  string
+	}{
+		{map[string]string{"draft": "maybe"}, `"draft"`},
+		{map[string]string{"updated": "yesterday"}, `"updated"`},
+		{map[string]string{"slug": "a/b"}, `"slug"`},
+		{map[string]string{"slug": ".."}, `"slug"`},
+		{map[string]string{"slug": ""}, `"slug"`},
+	}
+	for _, tc := range testCases {
+		err := (&FileInfo{}).applyMeta(tc.Meta)
+		if err == nil || !strings.Contains(err.Error(), tc.Err) {
+			t.Errorf("Wrong error for %v: Got %v, Want %s\n", tc.Meta, err, tc.Err)
+		}
+	}
+}
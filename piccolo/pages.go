@@ -0,0 +1,103 @@
+package piccolo
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"text/template"
+)
+
+// PageDir is the directory, relative to the main page, that the second and
+// later pages of the main index go in, e.g. page/2/index.html.
+const PageDir = "page"
+
+// paginate splits the entries into pages of at most n entries each. There is
+// always at least one page.
+func paginate(entries []*Entry, n int) [][]*Entry {
+	pages := [][]*Entry{}
+	for len(entries) > n {
+		pages = append(pages, entries[:n])
+		entries = entries[n:]
+	}
+	return append(pages, entries)
+}
+
+// dirURL returns the relative URL of the target directory dir, ending in a
+// slash. An empty dir is the root.
+func (b *Builder) dirURL(dir string) (string, error) {
+	if dir == "" {
+		return "/", nil
+	}
+	rel, err := filepath.Rel(b.d.Root, dir)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return "/", nil
+	}
+	return "/" + filepath.ToSlash(rel) + "/", nil
+}
+
+// pageURL returns the relative URL of page n of the main index.
+func (b *Builder) pageURL(n int) (string, error) {
+	u, err := b.dirURL(b.d.Main)
+	if err != nil {
+		return "", err
+	}
+	if n == 1 {
+		return u, nil
+	}
+	return u + PageDir + "/" + strconv.Itoa(n) + "/", nil
+}
+
+// buildIndex writes the main index. If PageLen is set then the entries are
+// split across as many pages as needed, otherwise the main index only has the
+// latest FeedLen entries.
+func (b *Builder) buildIndex(ctx context.Context, t *template.Template, site *TemplateData, entries []*Entry) error {
+	var pages [][]*Entry
+	if b.c.PageLen > 0 {
+		pages = paginate(entries, b.c.PageLen)
+	} else {
+		pages = paginate(entries, b.c.FeedLen)[:1]
+	}
+	for i, page := range pages {
+		n := i + 1
+		if err := b.loadBodies(ctx, page); err != nil {
+			return err
+		}
+		data := *site
+		data.Entries = page
+		data.PageNumber = n
+		data.TotalPages = len(pages)
+		var err error
+		if n > 1 {
+			if data.PrevURL, err = b.pageURL(n - 1); err != nil {
+				return err
+			}
+		}
+		if n < len(pages) {
+			if data.NextURL, err = b.pageURL(n + 1); err != nil {
+				return err
+			}
+		}
+		dir := b.d.Main
+		if n > 1 {
+			if dir == "" {
+				dir = b.d.Root
+			}
+			dir = filepath.Join(dir, PageDir, strconv.Itoa(n))
+		}
+		if err := b.expandPage(t, &data, dir, "index.html"); err != nil {
+			return fmt.Errorf("Error building index page %d: %v", n, err)
+		}
+		if n > 1 {
+			u, err := b.pageURL(n)
+			if err != nil {
+				return err
+			}
+			b.listed = append(b.listed, SitemapURL{Loc: u, LastMod: lastUpdated(page)})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package piccolo
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// The elements of an RSS 2.0 feed, see https://www.rssboard.org/rss-specification.
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          rssSelf   `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Generator     string    `xml:"generator"`
+	Items         []rssItem `xml:"item"`
+}
+
+// rssSelf is the URL of the feed itself, which RSS has no element for.
+type rssSelf struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	ID          string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+// WriteRSS writes the feed as RSS 2.0.
+func WriteRSS(w io.Writer, f *Feed) error {
+	feed := rssFeed{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.AbsURL(f.Link),
+			Description:   f.Title,
+			Self:          rssSelf{Rel: "self", Type: "application/rss+xml", Href: f.AbsURL(f.URL)},
+			LastBuildDate: f.Updated().Format(time.RFC1123Z),
+			Generator:     "piccolo",
+		},
+	}
+	for _, e := range f.Entries {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       e.Title,
+			Link:        f.AbsURL(e.URL),
+			GUID:        rssGUID{ID: f.EntryID(e)},
+			PubDate:     e.Created.Format(time.RFC1123Z),
+			Categories:  append(append([]string{}, e.Tags...), e.Categories...),
+			Description: e.FeedBody,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,86 @@
+package piccolo
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testFeed returns a Feed with two entries, newest first.
+func testFeed() *Feed {
+	created := time.Date(2009, 7, 4, 12, 0, 0, 0, time.UTC)
+	return &Feed{
+		Title:  "Tom & Jerry",
+		Domain: "https://example.org/",
+		Author: "Joe Gregorio",
+		URL:    "/feed/index.rss",
+		Link:   "/",
+		Entries: []*Entry{
+			{
+				Title:    "Newer",
+				URL:      "/a/new",
+				Author:   "Someone Else",
+				Created:  created.Add(24 * time.Hour),
+				Tags:     []string{"go"},
+				Summary:  "Short.",
+				FeedBody: "<p>New & improved.</p>",
+			},
+			{
+				Title:    "Older",
+				URL:      "/a/old",
+				Created:  created,
+				Updated:  created.Add(48 * time.Hour),
+				FeedBody: "<p>Old.</p>",
+			},
+		},
+	}
+}
+
+func TestWriteRSS(t *testing.T) {
+	f := testFeed()
+	var buf bytes.Buffer
+	if err := WriteRSS(&buf, f); err != nil {
+		t.Fatalf("Failed to write feed: %v\n", err)
+	}
+	var got struct {
+		Version string `xml:"version,attr"`
+		Channel struct {
+			Title         string    `xml:"title"`
+			LastBuildDate string    `xml:"lastBuildDate"`
+			Items         []rssItem `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Failed to parse feed: %v\n%s\n", err, buf.String())
+	}
+	if got.Version != "2.0" || got.Channel.Title != f.Title {
+		t.Errorf("Wrong channel: Got %q %q\n", got.Version, got.Channel.Title)
+	}
+	if got, want := got.Channel.LastBuildDate, "Mon, 06 Jul 2009 12:00:00 +0000"; got != want {
+		t.Errorf("Wrong lastBuildDate: Got %s, Want %s\n", got, want)
+	}
+	if got, want := len(got.Channel.Items), 2; got != want {
+		t.Fatalf("Wrong number of items: Got %d, Want %d\n", got, want)
+	}
+	item := got.Channel.Items[0]
+	if item.Title != "Newer" || item.Link != "https://example.org/a/new" || item.GUID.ID != "tag:example.org,2009-07-05:/a/new" {
+		t.Errorf("Wrong item: Got %q %q %q\n", item.Title, item.Link, item.GUID.ID)
+	}
+	if item.Description != f.Entries[0].FeedBody {
+		t.Errorf("Wrong description: Got %q, Want %q\n", item.Description, f.Entries[0].FeedBody)
+	}
+	if len(item.Categories) != 1 || item.Categories[0] != "go" {
+		t.Errorf("Wrong categories: Got %v\n", item.Categories)
+	}
+	for _, want := range []string{
+		`<link>https://example.org/</link>`,
+		`<atom:link rel="self" type="application/rss+xml" href="https://example.org/feed/index.rss">`,
+		`<guid isPermaLink="false">`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Missing %q:\n%s\n", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package piccolo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// SearchIndexFilename is the location of the search index, relative to the
+// output directory.
+const SearchIndexFilename = "search.json"
+
+// SearchDoc is a single entry in the search index. The JSON names are short
+// to keep the index small.
+type SearchDoc struct {
+	Title   string   `json:"t"`
+	URL     string   `json:"u"`
+	Created string   `json:"c"`
+	Tags    []string `json:"g,omitempty"`
+
+	// Words are the unique words of the text of the entry, in the order they
+	// first appear, as returned by Tokenize.
+	Words []string `json:"w"`
+}
+
+// SearchIndex is an index of all the published entries.
+type SearchIndex struct {
+	Docs []SearchDoc `json:"docs"`
+}
+
+// SearchResult is a single match from Search.
+type SearchResult struct {
+	SearchDoc
+
+	// Score is higher for better matches.
+	Score int `json:"score"`
+}
+
+// Tokenize splits text into lower case words.
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// uniqueWords returns the words without duplicates, in the order they first
+// appear.
+func uniqueWords(words []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, w := range words {
+		if !seen[w] {
+			seen[w] = true
+			unique = append(unique, w)
+		}
+	}
+	return unique
+}
+
+// BodyText returns the text of the nodes with the HTML stripped, skipping
+// scripts and styles.
+func BodyText(nodes []*html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(n.Data)
+			b.WriteString(" ")
+		case html.ElementNode:
+			if n.Data == "script" || n.Data == "style" {
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return b.String()
+}
+
+// NewSearchIndex returns the search index of the entries.
+func NewSearchIndex(entries []*Entry) *SearchIndex {
+	index := &SearchIndex{Docs: []SearchDoc{}}
+	for _, e := range entries {
+		index.Docs = append(index.Docs, SearchDoc{
+			Title:   e.Title,
+			URL:     e.URL,
+			Created: e.Created.Format("2006-01-02"),
+			Tags:    e.Tags,
+			Words:   uniqueWords(Tokenize(e.text)),
+		})
+	}
+	return index
+}
+
+// LoadSearchIndex loads a search index written by a build.
+func LoadSearchIndex(path string) (*SearchIndex, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	index := &SearchIndex{}
+	if err := json.Unmarshal(b, index); err != nil {
+		return nil, fmt.Errorf("Failed to parse search index %s: %s", path, err)
+	}
+	return index, nil
+}
+
+// Write writes the index as JSON.
+func (s *SearchIndex) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+// matches returns true if any of the words starts with term.
+func matches(words []string, term string) bool {
+	for _, w := range words {
+		if strings.HasPrefix(w, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// Search returns the documents in the index that match every word of the
+// query, best matches first. Words match the start of words in the title,
+// tags or text, with matches in the title counting the most and in the text
+// the least. Documents with the same score are ordered newest first.
+func Search(index *SearchIndex, query string) []SearchResult {
+	terms := uniqueWords(Tokenize(query))
+	results := []SearchResult{}
+	if len(terms) == 0 {
+		return results
+	}
+	for _, doc := range index.Docs {
+		title := Tokenize(doc.Title)
+		tags := Tokenize(strings.Join(doc.Tags, " "))
+		score := 0
+		for _, term := range terms {
+			s := 0
+			if matches(title, term) {
+				s += 3
+			}
+			if matches(tags, term) {
+				s += 2
+			}
+			if matches(doc.Words, term) {
+				s += 1
+			}
+			if s == 0 {
+				score = 0
+				break
+			}
+			score += s
+		}
+		if score > 0 {
+			results = append(results, SearchResult{SearchDoc: doc, Score: score})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Created > results[j].Created
+	})
+	return results
+}
+
+// writeSearchIndex writes the search index of the entries into the root of
+// the output directory.
+func (b *Builder) writeSearchIndex(entries []*Entry) error {
+	dst, err := b.dest(filepath.Join(b.d.Root, SearchIndexFilename))
+	if err != nil {
+		return err
+	}
+	index := NewSearchIndex(entries)
+	return b.write(dst, index.Write)
+}
@@ -0,0 +1,61 @@
+package piccolo
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+func TestTokenize(t *testing.T) {
+	got := strings.Join(Tokenize("Hello, World! Go-1.22 isn't ÜBER"), " ")
+	if want := "hello world go 1 22 isn t über"; got != want {
+		t.Errorf("Got %v, Want %v\n", got, want)
+	}
+}
+
+func TestBodyText(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<html><body><p>Some <b>bold</b> text.</p><script>var x = 1;</script><style>p {}</style></body></html>`))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v\n", err)
+	}
+	fi := FileInfo{Node: doc}
+	got := strings.Join(Tokenize(BodyText(fi.Body())), " ")
+	if want := "some bold text"; got != want {
+		t.Errorf("Got %v, Want %v\n", got, want)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2009, 7, d, 0, 0, 0, 0, time.UTC) }
+	index := NewSearchIndex([]*Entry{
+		{Title: "Go tips", URL: "/a/go", Created: day(1), text: "Goroutines and channels."},
+		{Title: "Python", URL: "/a/python", Created: day(2), Tags: []string{"go"}, text: "Not about it."},
+		{Title: "Cooking", URL: "/a/cooking", Created: day(3), text: "Let's go to the market, go now."},
+		{Title: "Channels", URL: "/a/channels", Created: day(4), text: "TV channels."},
+	})
+	if got, want := index.Docs[2].Words, []string{"let", "s", "go", "to", "the", "market", "now"}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Wrong words: Got %v, Want %v\n", got, want)
+	}
+	testCases := []struct {
+		query string
+		want  []string
+	}{
+		{"go", []string{"/a/go", "/a/python", "/a/cooking"}},
+		{"GO channels", []string{"/a/go"}},
+		{"chan", []string{"/a/channels", "/a/go"}},
+		{"market", []string{"/a/cooking"}},
+		{"nothing", []string{}},
+		{"  ", []string{}},
+	}
+	for _, tc := range testCases {
+		got := []string{}
+		for _, r := range Search(index, tc.query) {
+			got = append(got, r.URL)
+		}
+		if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+			t.Errorf("Search(%q): Got %v, Want %v\n", tc.query, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package piccolo
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SitemapURL is a single page of a sitemap.
+type SitemapURL struct {
+	// Loc is the absolute URL of the page.
+	Loc string
+
+	// LastMod is when the page was last modified, or zero if unknown.
+	LastMod time.Time
+}
+
+// The elements of a sitemap, see https://www.sitemaps.org/protocol.html.
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// WriteSitemap writes the URLs as a sitemap.
+func WriteSitemap(w io.Writer, urls []SitemapURL) error {
+	set := sitemapURLSet{}
+	for _, u := range urls {
+		su := sitemapURL{Loc: u.Loc}
+		if !u.LastMod.IsZero() {
+			su.LastMod = u.LastMod.Format(time.RFC3339)
+		}
+		set.URLs = append(set.URLs, su)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(set); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeSitemap writes sitemap.xml, and robots.txt if turned on, into the root
+// of the output directory. The sitemap has the main page, the archive, the
+// entries, the other pages generated by this build, such as the later index
+// pages and the tag pages, and the verbatim HTML pages at the paths in pages.
+func (b *Builder) writeSitemap(updated time.Time, entries []*Entry, pages []string) error {
+	if b.c.Domain == "" {
+		return fmt.Errorf("Invalid \"domain\": must be set to build a sitemap.")
+	}
+	f := newFeed(b.c, "", "", "", nil)
+	urls := []SitemapURL{}
+	for _, dir := range []string{b.d.Main, b.d.Archive} {
+		u, err := b.dirURL(dir)
+		if err != nil {
+			return err
+		}
+		if len(urls) == 0 || urls[0].Loc != f.AbsURL(u) {
+			urls = append(urls, SitemapURL{Loc: f.AbsURL(u), LastMod: updated})
+		}
+	}
+	for _, e := range entries {
+		urls = append(urls, SitemapURL{Loc: f.AbsURL(e.URL), LastMod: entryUpdated(e)})
+	}
+	for _, u := range b.listed {
+		urls = append(urls, SitemapURL{Loc: f.AbsURL(u.Loc), LastMod: u.LastMod})
+	}
+	for _, page := range pages {
+		u, err := b.d.URL(page)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(page)
+		if err != nil {
+			return err
+		}
+		urls = append(urls, SitemapURL{Loc: f.AbsURL(u), LastMod: info.ModTime()})
+	}
+
+	dst, err := b.dest(filepath.Join(b.d.Root, "sitemap.xml"))
+	if err != nil {
+		return err
+	}
+	if err := b.write(dst, func(w io.Writer) error {
+		return WriteSitemap(w, urls)
+	}); err != nil {
+		return err
+	}
+	if !b.c.Robots {
+		return nil
+	}
+	robots := filepath.Join(b.d.Root, "robots.txt")
+	if _, err := os.Stat(robots); err == nil {
+		return fmt.Errorf("Invalid \"robots\": %s already exists.", robots)
+	}
+	if dst, err = b.dest(robots); err != nil {
+		return err
+	}
+	return b.write(dst, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "User-agent: *\nAllow: /\n\nSitemap: %s\n", f.AbsURL("/sitemap.xml"))
+		return err
+	})
+}
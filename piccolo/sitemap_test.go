@@ -0,0 +1,29 @@
+package piccolo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteSitemap(t *testing.T) {
+	var buf bytes.Buffer
+	urls := []SitemapURL{
+		{Loc: "https://example.org/", LastMod: time.Date(2009, 7, 4, 12, 0, 0, 0, time.UTC)},
+		{Loc: "https://example.org/a?b=1&c=2"},
+	}
+	if err := WriteSitemap(&buf, urls); err != nil {
+		t.Fatalf("Failed to write sitemap: %v\n", err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`,
+		"<loc>https://example.org/</loc>\n    <lastmod>2009-07-04T12:00:00Z</lastmod>",
+		"<loc>https://example.org/a?b=1&amp;c=2</loc>\n  </url>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Sitemap missing %q:\n%s\n", want, got)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package piccolo
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// TagsDir is the directory, relative to the root, that the tag pages go in.
+const TagsDir = "tags"
+
+// CategoriesDir is the directory, relative to the root, that the category
+// pages go in.
+const CategoriesDir = "categories"
+
+// Slugify turns a title or tag into something usable as a filename or URL
+// path segment, e.g. "Hello, World" into "hello-world".
+func Slugify(title string) string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
+
+// Tag is a single tag, or category, and the entries that have it.
+type Tag struct {
+	// Name of the tag, as it first appeared in an entry.
+	Name string
+
+	// Slug is the URL path segment for the tag.
+	Slug string
+
+	// URL is the relative URL of the tag page.
+	URL string
+
+	// Entries with this tag, newest first.
+	Entries []*Entry
+
+	// Size is from 1 to 5, by how many entries have the tag compared to the
+	// other tags, for sizing the tag in a tag cloud.
+	Size int
+
+	// merged are the other names, not only differing in case from Name, that
+	// have the same slug, e.g. "C" for "C++".
+	merged []string
+}
+
+// Count is the number of entries with the tag.
+func (t *Tag) Count() int {
+	return len(t.Entries)
+}
+
+// CollectTags returns all the tags of the entries, sorted by slug. Tags that
+// have the same slug, e.g. "Go" and "go", or "C++" and "C", are treated as the
+// same tag.
+func CollectTags(entries []*Entry) []*Tag {
+	return collectTerms(entries, TagsDir, func(e *Entry) []string { return e.Tags })
+}
+
+// CollectCategories returns all the categories of the entries, the same way
+// CollectTags does for tags.
+func CollectCategories(entries []*Entry) []*Tag {
+	return collectTerms(entries, CategoriesDir, func(e *Entry) []string { return e.Categories })
+}
+
+// collectTerms returns the tags given by terms for each of the entries, with
+// their pages in the directory dir.
+func collectTerms(entries []*Entry, dir string, terms func(*Entry) []string) []*Tag {
+	bySlug := map[string]*Tag{}
+	names := map[string]bool{}
+	tags := []*Tag{}
+	for _, e := range entries {
+		seen := map[string]bool{}
+		for _, name := range terms(e) {
+			slug := Slugify(name)
+			if slug == "" || seen[slug] {
+				continue
+			}
+			seen[slug] = true
+			t, ok := bySlug[slug]
+			if !ok {
+				t = &Tag{
+					Name: name,
+					Slug: slug,
+					URL:  "/" + dir + "/" + slug + "/",
+				}
+				bySlug[slug] = t
+				tags = append(tags, t)
+			} else if !strings.EqualFold(name, t.Name) && !names[name] {
+				t.merged = append(t.merged, name)
+			}
+			names[name] = true
+			t.Entries = append(t.Entries, e)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Slug < tags[j].Slug })
+
+	max := 0
+	for _, t := range tags {
+		if t.Count() > max {
+			max = t.Count()
+		}
+	}
+	for _, t := range tags {
+		t.Size = 1
+		if max > 1 {
+			t.Size += (4 * (t.Count() - 1)) / (max - 1)
+		}
+	}
+	return tags
+}
+
+// collisions returns a warning for every tag that has names merged into it.
+func collisions(taxonomy string, tags []*Tag) []string {
+	warnings := []string{}
+	for _, t := range tags {
+		for _, name := range t.merged {
+			warnings = append(warnings, fmt.Sprintf("The %s %q and %q are both published to %s.", taxonomy, t.Name, name, t.URL))
+		}
+	}
+	return warnings
+}
+
+// buildTags writes the pages and feeds, see buildTerms, for the tags and, if
+// any entry has one, the categories. It returns warnings for the terms that
+// were merged because they have the same slug.
+func (b *Builder) buildTags(ctx context.Context, templates *Templates, site *TemplateData, entries []*Entry, sources map[string]string) ([]string, error) {
+	tags := CollectTags(entries)
+	if err := b.buildTerms(ctx, templates, site, entries, TagsDir, tags, sources); err != nil {
+		return nil, err
+	}
+	warnings := collisions(TagsDir, tags)
+	categories := CollectCategories(entries)
+	if len(categories) == 0 {
+		return warnings, nil
+	}
+	if err := b.buildTerms(ctx, templates, site, entries, CategoriesDir, categories, sources); err != nil {
+		return nil, err
+	}
+	return append(warnings, collisions(CategoriesDir, categories)...), nil
+}
+
+// buildTerms writes an Atom feed for every tag and, if their templates exist,
+// a page for every tag and the tag cloud page, into the directory taxonomy.
+// sources are the source paths of the other outputs, indexed by destination,
+// which none of the pages may overwrite.
+func (b *Builder) buildTerms(ctx context.Context, templates *Templates, site *TemplateData, entries []*Entry, taxonomy string, tags []*Tag, sources map[string]string) error {
+	dir := filepath.Join(b.d.Root, taxonomy)
+	published := func(pageDir string, names ...string) error {
+		for _, name := range names {
+			dst, err := b.pageDest(pageDir, name)
+			if err != nil {
+				return err
+			}
+			if src, ok := sources[dst]; ok {
+				return fmt.Errorf("%s and the %s pages are both published to %s.", src, taxonomy, dst)
+			}
+		}
+		return nil
+	}
+	// Pages are only checked if they are written.
+	pages := []string{}
+	if templates.TagHTML != nil {
+		pages = append(pages, "index.html")
+	}
+	if b.c.Domain != "" {
+		for _, format := range b.feedFormats() {
+			pages = append(pages, format.name)
+		}
+	}
+	if templates.TagsHTML != nil {
+		if err := published(dir, "index.html"); err != nil {
+			return err
+		}
+	}
+	for _, t := range tags {
+		if err := published(filepath.Join(dir, t.Slug), pages...); err != nil {
+			return err
+		}
+	}
+	// Each page needs its own datediff, otherwise the headings depend on the
+	// page expanded before it.
+	expand := func(t *template.Template, data *TemplateData, pageDir string) error {
+		fresh, err := withFreshState(t)
+		if err != nil {
+			return err
+		}
+		if err := b.expandPage(fresh, data, pageDir, "index.html"); err != nil {
+			return err
+		}
+		u, err := b.dirURL(pageDir)
+		if err != nil {
+			return err
+		}
+		b.listed = append(b.listed, SitemapURL{Loc: u, LastMod: lastUpdated(data.Entries)})
+		return nil
+	}
+	if templates.TagsHTML != nil {
+		data := *site
+		data.Tags = tags
+		data.Taxonomy = taxonomy
+		data.Entries = entries
+		if err := expand(templates.TagsHTML, &data, dir); err != nil {
+			return fmt.Errorf("Error building %s cloud: %v", taxonomy, err)
+		}
+	}
+	for _, t := range tags {
+		data := *site
+		data.Tag = t
+		data.Tags = tags
+		data.Taxonomy = taxonomy
+		data.Entries = t.Entries
+		data.Updated = lastUpdated(t.Entries)
+		tagDir := filepath.Join(dir, t.Slug)
+		if templates.TagHTML != nil {
+			if err := expand(templates.TagHTML, &data, tagDir); err != nil {
+				return fmt.Errorf("Error building %s %q: %v", taxonomy, t.Name, err)
+			}
+		}
+		latest := t.Entries
+		if len(latest) > b.c.FeedLen {
+			latest = latest[:b.c.FeedLen]
+		}
+		if err := b.loadBodies(ctx, latest); err != nil {
+			return err
+		}
+		title := fmt.Sprintf("%s | %s", site.SiteTitle, t.Name)
+		if err := b.writeFeed(title, t.URL, tagDir, latest); err != nil {
+			return fmt.Errorf("Error building feed for %s %q: %v", taxonomy, t.Name, err)
+		}
+	}
+	return nil
+}
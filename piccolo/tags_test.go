@@ -0,0 +1,83 @@
+package piccolo
+
+import (
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want string
+	}{
+		{"Hello, World", "hello-world"},
+		{"  Go  ", "go"},
+		{"C++ & Go", "c-go"},
+		{"Ünïcode 2", "ünïcode-2"},
+		{"!!!", ""},
+	}
+	for _, tc := range testCases {
+		if got := Slugify(tc.in); got != tc.want {
+			t.Errorf("Slugify(%q): Got %q, Want %q\n", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestCollectTags(t *testing.T) {
+	a := &Entry{Title: "a", Tags: []string{"Go", "web"}}
+	b := &Entry{Title: "b", Tags: []string{"go", "Go"}}
+	c := &Entry{Title: "c", Tags: []string{"go", "!!"}}
+	tags := CollectTags([]*Entry{a, b, c})
+	if got, want := len(tags), 2; got != want {
+		t.Fatalf("Wrong number of tags: Got %d, Want %d\n", got, want)
+	}
+	testCases := []struct {
+		name  string
+		slug  string
+		url   string
+		count int
+		size  int
+	}{
+		{"Go", "go", "/tags/go/", 3, 5},
+		{"web", "web", "/tags/web/", 1, 1},
+	}
+	for i, tc := range testCases {
+		tag := tags[i]
+		if tag.Name != tc.name || tag.Slug != tc.slug || tag.URL != tc.url {
+			t.Errorf("Wrong tag: Got %q %q %q, Want %q %q %q\n", tag.Name, tag.Slug, tag.URL, tc.name, tc.slug, tc.url)
+		}
+		if got := tag.Count(); got != tc.count {
+			t.Errorf("Wrong count for %s: Got %d, Want %d\n", tc.name, got, tc.count)
+		}
+		if tag.Size != tc.size {
+			t.Errorf("Wrong size for %s: Got %d, Want %d\n", tc.name, tag.Size, tc.size)
+		}
+	}
+	if got := tags[0].Entries; got[0] != a || got[1] != b || got[2] != c {
+		t.Errorf("Wrong entries for go, order must be kept.\n")
+	}
+}
+
+func TestCollisions(t *testing.T) {
+	a := &Entry{Title: "a", Tags: []string{"C++", "Go"}}
+	b := &Entry{Title: "b", Tags: []string{"c", "go", "C"}}
+	got := collisions(TagsDir, CollectTags([]*Entry{a, b}))
+	want := []string{`The tags "C++" and "c" are both published to /tags/c/.`}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("Got %v, Want %v\n", got, want)
+	}
+}
+
+func TestCollectCategories(t *testing.T) {
+	a := &Entry{Title: "a", Tags: []string{"go"}, Categories: []string{"Programming"}}
+	b := &Entry{Title: "b", Categories: []string{"programming"}}
+	categories := CollectCategories([]*Entry{a, b})
+	if got, want := len(categories), 1; got != want {
+		t.Fatalf("Wrong number of categories: Got %d, Want %d\n", got, want)
+	}
+	if got, want := categories[0].URL, "/categories/programming/"; got != want {
+		t.Errorf("Got %v, Want %v\n", got, want)
+	}
+	if got, want := categories[0].Count(), 2; got != want {
+		t.Errorf("Got %v, Want %v\n", got, want)
+	}
+}
@@ -0,0 +1,238 @@
+package piccolo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var shortMonths = [...]string{
+	"Jan",
+	"Feb",
+	"Mar",
+	"Apr",
+	"May",
+	"Jun",
+	"Jul",
+	"Aug",
+	"Sep",
+	"Oct",
+	"Nov",
+	"Dec",
+}
+
+// ShortMonth returns the short English name of the month ("Jan", "Feb", ...).
+func ShortMonth(m time.Month) string { return shortMonths[m-1] }
+
+type datediffer func(time.Time) string
+
+// datediff returns a function that formats the archive entries correctly.
+//
+// The returned function is a closure that keeps track of the last time.Time it
+// saw which it needs to do the formatting correctly. It is safe to call from
+// multiple goroutines, though the output only makes sense when called in
+// order.
+func datediff() datediffer {
+	var last time.Time
+	var mutex sync.Mutex
+
+	return func(t time.Time) string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		r := ""
+		if t.After(last) {
+			r = fmt.Sprintf("foo %#v", t)
+		}
+		// If years differ, emit year, month, day
+		if t.Year() != last.Year() {
+			r = fmt.Sprintf("<i><b>%d</b></i></td><td></td></tr>\n    <tr><td><b>%s</b></td><td></td></tr>\n    <tr><td> %d", t.Year(), ShortMonth(t.Month()), t.Day())
+		} else if t.Month() != last.Month() {
+			r = fmt.Sprintf("<b>%s</b></td><td></td></tr>\n   <tr><td> %d", ShortMonth(t.Month()), t.Day())
+		} else {
+			r = fmt.Sprintf("%d", t.Day())
+		}
+		last = t
+		return r
+	}
+}
+
+// trunc10 formats a time to just the year, month and day in ISO format.
+func trunc10(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// rfc339 formats a time in RFC3339 format.
+func rfc3339(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+// Templates contains all the parsed templates.
+type Templates struct {
+	IndexHTML   *template.Template
+	ArchiveHTML *template.Template
+	EntryHTML   *template.Template
+
+	// The tag templates are optional and are nil if the template file doesn't
+	// exist.
+	TagHTML  *template.Template
+	TagsHTML *template.Template
+}
+
+// withFreshState returns a copy of the template whose stateful functions,
+// i.e. datediff, start over.
+func withFreshState(t *template.Template) (*template.Template, error) {
+	c, err := t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return c.Funcs(template.FuncMap{"datediff": datediff()}), nil
+}
+
+func loadTemplate(root, name string) (*template.Template, error) {
+	funcMap := template.FuncMap{
+		"datediff": datediff(),
+		"trunc10":  trunc10,
+		"rfc3339":  rfc3339,
+	}
+
+	fullname := filepath.Join(root, "tpl", name)
+	return template.New(name).Funcs(funcMap).ParseFiles(fullname)
+}
+
+// LoadTemplates loads and parses the templates named in the config from the
+// tpl directory below root.
+func LoadTemplates(root string, c *Config) (*Templates, error) {
+	names := c.Templates
+	t := &Templates{}
+	var err error
+	if t.IndexHTML, err = loadTemplate(root, names.Index); err != nil {
+		return nil, err
+	}
+	if t.ArchiveHTML, err = loadTemplate(root, names.Archive); err != nil {
+		return nil, err
+	}
+	if t.EntryHTML, err = loadTemplate(root, names.Entry); err != nil {
+		return nil, err
+	}
+	optional := []struct {
+		t    **template.Template
+		name string
+	}{
+		{&t.TagHTML, names.Tag},
+		{&t.TagsHTML, names.Tags},
+	}
+	for _, o := range optional {
+		if _, err := os.Stat(filepath.Join(root, "tpl", o.name)); os.IsNotExist(err) {
+			continue
+		}
+		if *o.t, err = loadTemplate(root, o.name); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Entry represents a single blog entry.
+type Entry struct {
+	// Path is the source file path.
+	Path string
+
+	// Title is the title of the entry.
+	Title string
+
+	// URL is the relative URL of the file.
+	URL string
+
+	// Tags and Categories of the entry.
+	Tags       []string
+	Categories []string
+
+	// Summary is a short description of the entry.
+	Summary string
+
+	// Author is the author of the entry, if different from the site author.
+	Author string
+
+	// Draft is true for entries that aren't to be published.
+	Draft bool
+
+	// Meta is all the metadata of the entry, indexed by name.
+	Meta map[string]string
+
+	// Created is the created time.
+	Created time.Time
+
+	// Updated is the updated time.
+	Updated time.Time
+
+	// Body is the string representation of the body element, w/o
+	// the <body> tags.
+	Body string
+
+	// FeedBody is Body with every relative URL made absolute, which is what
+	// goes in the feeds.
+	FeedBody string
+
+	// text is the text of the body, with the HTML stripped, for the search
+	// index.
+	text string
+}
+
+// EntryByCreated is a type that allows sorting Entries by their created time.
+type EntryByCreated []*Entry
+
+func (s EntryByCreated) Len() int           { return len(s) }
+func (s EntryByCreated) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s EntryByCreated) Less(i, j int) bool { return s[i].Created.After(s[j].Created) }
+
+// TemplateData is the data used for expanding the index and archive templates.
+type TemplateData struct {
+	// Domain is the domain name the site will be served from.
+	Domain string
+
+	SiteTitle string
+	Author    string
+	Header    string
+	InlineCSS string
+	Titlebar  string
+	Footer    string
+	Entries   []*Entry
+
+	// HighlightCSS is the CSS for syntax highlighted code, only set if the
+	// highlight config has classes turned on.
+	HighlightCSS string
+
+	// Tag is the tag, or category, the page is for, only set on tag pages.
+	Tag *Tag
+
+	// Tags are all the tags, or all the categories, only set on tag pages and
+	// the tag cloud.
+	Tags []*Tag
+
+	// Taxonomy is the directory of the tag pages, TagsDir or CategoriesDir,
+	// which says whether they are for tags or categories.
+	Taxonomy string
+
+	// PageNumber and TotalPages are set on the pages of the main index, which
+	// are numbered from 1. PrevURL is the URL of the page with newer entries
+	// and NextURL the page with older entries, either is empty if there is no
+	// such page.
+	PageNumber int
+	TotalPages int
+	PrevURL    string
+	NextURL    string
+
+	// Years is the archive, all the entries grouped by year and month.
+	Years []*Year
+
+	// Year is the year of a year or month archive page, and Month the month
+	// of a month archive page, only set on those pages.
+	Year  *Year
+	Month *Month
+
+	// Most recent time anything on the site was updated.
+	Updated time.Time
+}
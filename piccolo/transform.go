@@ -0,0 +1,130 @@
+package piccolo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Transform changes the parsed HTML of an entry, FileInfo.Node, before it is
+// published, e.g. by turning custom elements into plain HTML.
+//
+// Transforms are applied to every entry in the order given by the
+// "transforms" config, and what they produce is used both for the entry page
+// and for the feeds.
+type Transform interface {
+	Transform(ctx context.Context, fi *FileInfo) error
+}
+
+// TransformFunc adapts a function into a Transform.
+type TransformFunc func(ctx context.Context, fi *FileInfo) error
+
+// Transform calls f.
+func (f TransformFunc) Transform(ctx context.Context, fi *FileInfo) error {
+	return f(ctx, fi)
+}
+
+var (
+	transformsMutex sync.Mutex
+	transforms      = map[string]Transform{}
+)
+
+// RegisterTransform makes a Transform available under the given name for use
+// in the "transforms" config. It is meant to be called from init functions,
+// and panics if the name is already registered.
+func RegisterTransform(name string, t Transform) {
+	transformsMutex.Lock()
+	defer transformsMutex.Unlock()
+	if _, ok := transforms[name]; ok {
+		panic(fmt.Sprintf("Transform %q registered twice.", name))
+	}
+	transforms[name] = t
+}
+
+// TransformNames returns the names of all the registered transforms, sorted.
+func TransformNames() []string {
+	transformsMutex.Lock()
+	defer transformsMutex.Unlock()
+	names := []string{}
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupTransforms returns the registered transforms with the given names, in
+// the same order.
+func LookupTransforms(names []string) ([]Transform, error) {
+	transformsMutex.Lock()
+	defer transformsMutex.Unlock()
+	ts := []Transform{}
+	for _, name := range names {
+		t, ok := transforms[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown transform %q.", name)
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+type docSetKey struct{}
+
+// WithDocSet returns a context that carries the docset, for transforms that
+// need to know about the site, e.g. to find files relative to the root.
+func WithDocSet(ctx context.Context, d *DocSet) context.Context {
+	return context.WithValue(ctx, docSetKey{}, d)
+}
+
+// DocSetFromContext returns the docset carried by the context, or nil if
+// there isn't one.
+func DocSetFromContext(ctx context.Context) *DocSet {
+	d, _ := ctx.Value(docSetKey{}).(*DocSet)
+	return d
+}
+
+type configKey struct{}
+
+// WithConfig returns a context that carries the config the site is being built
+// with, which transforms should use rather than the config of the docset.
+func WithConfig(ctx context.Context, c *Config) context.Context {
+	return context.WithValue(ctx, configKey{}, c)
+}
+
+// ConfigFromContext returns the config carried by the context, or if there
+// isn't one the config of the docset carried by the context, or nil if there
+// is neither.
+func ConfigFromContext(ctx context.Context) *Config {
+	if c, ok := ctx.Value(configKey{}).(*Config); ok {
+		return c
+	}
+	if d := DocSetFromContext(ctx); d != nil {
+		return d.Config
+	}
+	return nil
+}
+
+// WriteFileFunc writes the contents b into the file name, relative to the
+// output directory, and returns the URL of the file. Transforms use it to
+// publish files that an entry refers to, such as images.
+//
+// The name should depend on the contents, as a file that already exists isn't
+// written again.
+type WriteFileFunc func(name string, b []byte) (string, error)
+
+type writeFileKey struct{}
+
+// WithWriteFile returns a context that carries the function transforms use to
+// write files.
+func WithWriteFile(ctx context.Context, f WriteFileFunc) context.Context {
+	return context.WithValue(ctx, writeFileKey{}, f)
+}
+
+// WriteFileFromContext returns the function carried by the context for
+// writing files, or nil if there isn't one.
+func WriteFileFromContext(ctx context.Context) WriteFileFunc {
+	f, _ := ctx.Value(writeFileKey{}).(WriteFileFunc)
+	return f
+}
@@ -0,0 +1,82 @@
+package piccolo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// appendText returns a Transform that appends a paragraph with the text to
+// the body of the entry.
+func appendText(text string) Transform {
+	return TransformFunc(func(ctx context.Context, fi *FileInfo) error {
+		if DocSetFromContext(ctx) == nil {
+			return fmt.Errorf("No docset.")
+		}
+		var body *html.Node
+		var find func(*html.Node)
+		find = func(n *html.Node) {
+			if n.Type == html.ElementNode && n.Data == "body" {
+				body = n
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				find(c)
+			}
+		}
+		find(fi.Node)
+		p := &html.Node{Type: html.ElementNode, Data: "p"}
+		p.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+		body.AppendChild(p)
+		return nil
+	})
+}
+
+func init() {
+	RegisterTransform("test-first", appendText("first"))
+	RegisterTransform("test-second", appendText("second"))
+	RegisterTransform("test-fail", TransformFunc(func(ctx context.Context, fi *FileInfo) error {
+		return fmt.Errorf("Always fails.")
+	}))
+}
+
+func TestLookupTransforms(t *testing.T) {
+	if _, err := LookupTransforms([]string{"test-second", "latex", "test-first"}); err != nil {
+		t.Errorf("Failed to look up transforms: %v\n", err)
+	}
+	if _, err := LookupTransforms([]string{"test-first", "nope"}); err == nil || !strings.Contains(err.Error(), `"nope"`) {
+		t.Errorf("Wrong error for unknown transform: Got %v\n", err)
+	}
+	names := strings.Join(TransformNames(), " ")
+	if !strings.Contains(names, "latex") || !strings.Contains(names, "test-first test-second") {
+		t.Errorf("Wrong names: Got %v\n", names)
+	}
+}
+
+func TestRegisterTransformTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Registering a transform twice didn't panic.\n")
+		}
+	}()
+	RegisterTransform("test-first", appendText("again"))
+}
+
+func TestConfigFromContext(t *testing.T) {
+	ctx := context.Background()
+	if got := ConfigFromContext(ctx); got != nil {
+		t.Errorf("Got %v, Want nil\n", got)
+	}
+	d := &DocSet{Config: DefaultConfig()}
+	ctx = WithDocSet(ctx, d)
+	if got, want := ConfigFromContext(ctx), d.Config; got != want {
+		t.Errorf("Got %v, Want %v\n", got, want)
+	}
+	// The builder's config takes precedence over the docset's.
+	c := DefaultConfig()
+	if got, want := ConfigFromContext(WithConfig(ctx, c)), c; got != want {
+		t.Errorf("Got %v, Want %v\n", got, want)
+	}
+}
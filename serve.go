@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcgregorio/piccolo/piccolo"
+)
+
+// Values of the flags of the serve command.
+var (
+	serveAddr     string
+	serveWatch    bool
+	serveInterval time.Duration
+)
+
+var serveCmd = &Command{
+	Name:  "serve",
+	Short: "Serve the output directory over HTTP, rebuilding the site when the source changes.",
+	Flags: func(fs *flag.FlagSet) {
+		buildFlags(fs)
+		fs.StringVar(&serveAddr, "addr", "localhost:8000", "The address to listen on.")
+		fs.BoolVar(&serveWatch, "watch", true, "Watch the source tree and rebuild on changes.")
+		fs.DurationVar(&serveInterval, "interval", 500*time.Millisecond, "How often to poll the source tree for changes.")
+	},
+	Run: func(d *piccolo.DocSet, args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		return serve(d)
+	},
+}
+
+// reloadPath is the URL of the event stream that tells pages to reload.
+const reloadPath = "/_piccolo/reload"
+
+// reloadScript is injected into every HTML page served so that the browser
+// reloads the page after each rebuild.
+const reloadScript = `<script>new EventSource("` + reloadPath + `").onmessage = function() { location.reload(); };</script>`
+
+// reloader keeps track of the browsers waiting to be told to reload.
+type reloader struct {
+	mutex   sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+func newReloader() *reloader {
+	return &reloader{clients: map[chan struct{}]bool{}}
+}
+
+// Reload tells every connected browser to reload.
+func (r *reloader) Reload() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for c := range r.clients {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ServeHTTP serves the reload event stream.
+func (r *reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported.", http.StatusInternalServerError)
+		return
+	}
+	c := make(chan struct{}, 1)
+	r.mutex.Lock()
+	r.clients[c] = true
+	r.mutex.Unlock()
+	defer func() {
+		r.mutex.Lock()
+		delete(r.clients, c)
+		r.mutex.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-c:
+			fmt.Fprintf(w, "data: reload\n\n")
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// output is the output directory being served, and whether it has a search
+// index, which can change with the config on each rebuild.
+type output struct {
+	mutex  sync.Mutex
+	dst    string
+	search bool
+}
+
+// Set updates the output from the config of the docset d.
+func (o *output) Set(d *piccolo.DocSet) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.dst = filepath.Join(d.Root, d.Config.Output)
+	o.search = d.Config.Search
+}
+
+// Get returns the output directory and whether search is turned on.
+func (o *output) Get() (string, bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.dst, o.search
+}
+
+// siteHandler serves the output directory, mapping the extension-less URLs
+// produced by DocSet.URL back onto the .html files.
+type siteHandler struct {
+	out *output
+}
+
+func (s siteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	dst, _ := s.out.Get()
+	name := piccolo.ResolveURL(dst, r.URL.Path)
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if filepath.Ext(name) == ".html" {
+		b = injectReload(b)
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, filepath.Base(name), time.Time{}, bytes.NewReader(b))
+}
+
+// searchPath is the URL that answers search queries, e.g.
+// /_piccolo/search?q=go. It's below /_piccolo/ so it can't hide a page of the
+// site.
+const searchPath = "/_piccolo/search"
+
+// searchHandler answers search queries from the search index written by the
+// build, as JSON, if search is turned on.
+type searchHandler struct {
+	out *output
+}
+
+func (s searchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	dst, search := s.out.Get()
+	if !search {
+		http.NotFound(w, r)
+		return
+	}
+	index, err := piccolo.LoadSearchIndex(filepath.Join(dst, piccolo.SearchIndexFilename))
+	if os.IsNotExist(err) {
+		http.Error(w, "No search index, turn on \"search\" in "+piccolo.ConfigFilename+".", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query().Get("q")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Query   string                 `json:"query"`
+		Results []piccolo.SearchResult `json:"results"`
+	}{q, piccolo.Search(index, q)})
+}
+
+// injectReload adds the reload script to an HTML page, just before the
+// closing body tag if there is one.
+func injectReload(b []byte) []byte {
+	page := string(b)
+	i := strings.LastIndex(strings.ToLower(page), "</body>")
+	if i == -1 {
+		return []byte(page + reloadScript)
+	}
+	return []byte(page[:i] + reloadScript + page[i:])
+}
+
+// snapshot returns the modification times of every file in the source tree,
+// excluding the output directory.
+func snapshot(root, dst string) map[string]time.Time {
+	times := map[string]time.Time{}
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			switch path {
+			case dst, filepath.Join(root, "tmp"), filepath.Join(root, ".git"):
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		times[path] = info.ModTime()
+		return nil
+	})
+	return times
+}
+
+// changed returns true if the two snapshots differ.
+func changed(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return true
+	}
+	for path, t := range a {
+		if u, ok := b[path]; !ok || !t.Equal(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch polls the source tree of the docset and rebuilds the site whenever a
+// file is added, removed or modified, then points out at the new output
+// directory and tells the browsers to reload.
+func watch(d *piccolo.DocSet, out *output, r *reloader) {
+	root := d.Root
+	dst, _ := out.Get()
+	last := snapshot(root, dst)
+	for range time.Tick(serveInterval) {
+		current := snapshot(root, dst)
+		if !changed(last, current) {
+			continue
+		}
+		last = current
+		// Start with a fresh DocSet so that added or removed attribute files
+		// and config changes are picked up.
+		d, err := piccolo.NewDocSet(root)
+		if err == nil {
+			err = build(d)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Rebuild failed: %v\n", err)
+			continue
+		}
+		fmt.Printf("Rebuilt at %s\n", time.Now().Format(time.Kitchen))
+		// The config may have moved the output directory.
+		out.Set(d)
+		dst, _ = out.Get()
+		// Files written by the build, e.g. new created metadata, shouldn't
+		// trigger another rebuild.
+		last = snapshot(root, dst)
+		r.Reload()
+	}
+}
+
+// serve builds the site, then serves it, rebuilding on changes if --watch is
+// set.
+func serve(d *piccolo.DocSet) error {
+	if err := build(d); err != nil {
+		return err
+	}
+	out := &output{}
+	out.Set(d)
+	r := newReloader()
+	mux := http.NewServeMux()
+	mux.Handle(reloadPath, r)
+	mux.Handle(searchPath, searchHandler{out: out})
+	mux.Handle("/", siteHandler{out: out})
+	if serveWatch {
+		go watch(d, out, r)
+	}
+	dst, _ := out.Get()
+	fmt.Printf("Serving %s on http://%s/\n", dst, serveAddr)
+	return http.ListenAndServe(serveAddr, mux)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcgregorio/piccolo/piccolo"
+)
+
+func TestInjectReload(t *testing.T) {
+	testCases := []struct {
+		page string
+		want string
+	}{
+		{"<html><body><p>Hi</p></body></html>", "<html><body><p>Hi</p>" + reloadScript + "</body></html>"},
+		{"<HTML><BODY>Hi</BODY></HTML>", "<HTML><BODY>Hi" + reloadScript + "</BODY></HTML>"},
+		{"<p>No body</p>", "<p>No body</p>" + reloadScript},
+		{"<body><pre>&lt;/body&gt;</pre></body>", "<body><pre>&lt;/body&gt;</pre>" + reloadScript + "</body>"},
+	}
+	for _, tc := range testCases {
+		if got := string(injectReload([]byte(tc.page))); got != tc.want {
+			t.Errorf("Got %v, Want %v\n", got, tc.want)
+		}
+	}
+}
+
+func TestChanged(t *testing.T) {
+	root := t.TempDir()
+	dst := filepath.Join(root, "dst")
+	for _, name := range []string{"a/entry.html", "dst/a/entry.html", "tmp/latex/x.png"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v\n", err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x"), 0644); err != nil {
+			t.Fatalf("Failed to write: %v\n", err)
+		}
+	}
+	last := snapshot(root, dst)
+	if got, want := len(last), 1; got != want {
+		t.Fatalf("Snapshot has the output or tmp files: Got %d files, Want %d\n", got, want)
+	}
+	if changed(last, snapshot(root, dst)) {
+		t.Errorf("Unchanged tree reported as changed.\n")
+	}
+
+	// Writing the output isn't a change, but touching a source is.
+	if err := os.WriteFile(filepath.Join(dst, "index.html"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to write: %v\n", err)
+	}
+	if changed(last, snapshot(root, dst)) {
+		t.Errorf("Output change reported as changed.\n")
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "a", "entry.html"), later, later); err != nil {
+		t.Fatalf("Failed to touch: %v\n", err)
+	}
+	if !changed(last, snapshot(root, dst)) {
+		t.Errorf("Modified file not reported as changed.\n")
+	}
+	if err := os.WriteFile(filepath.Join(root, "a", "new.html"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to write: %v\n", err)
+	}
+	if !changed(last, snapshot(root, dst)) {
+		t.Errorf("Added file not reported as changed.\n")
+	}
+}
+
+func TestSiteHandlerFollowsOutput(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"dst", "out"} {
+		if err := os.MkdirAll(filepath.Join(root, dir, "a"), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v\n", err)
+		}
+		if err := os.WriteFile(filepath.Join(root, dir, "a", "entry.html"), []byte("<body>"+dir+"</body>"), 0644); err != nil {
+			t.Fatalf("Failed to write: %v\n", err)
+		}
+	}
+	d := &piccolo.DocSet{Root: root, Config: &piccolo.Config{Output: "dst"}}
+	out := &output{}
+	out.Set(d)
+	get := func(h http.Handler, url string) (int, string) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		b, _ := io.ReadAll(w.Result().Body)
+		return w.Code, string(b)
+	}
+	if _, got := get(siteHandler{out: out}, "/a/entry"); !strings.HasPrefix(got, "<body>dst"+reloadScript) {
+		t.Errorf("Wrong page: Got %q\n", got)
+	}
+	if code, _ := get(searchHandler{out: out}, searchPath+"?q=x"); code != http.StatusNotFound {
+		t.Errorf("Search answered when turned off: Got %d\n", code)
+	}
+
+	// A rebuild with a new output directory is served from there.
+	d.Config = &piccolo.Config{Output: "out"}
+	out.Set(d)
+	if _, got := get(siteHandler{out: out}, "/a/entry"); !strings.HasPrefix(got, "<body>out") {
+		t.Errorf("Old output served: Got %q\n", got)
+	}
+}